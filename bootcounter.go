@@ -0,0 +1,141 @@
+/*
+Redundant boot counter
+
+Boot number is solved from latest entry of logs. If those files are lost or corrupted, boot numbering restarts
+and old TimeVariables become ambiguous. Boot counter can be stored also on redundant locations (second partition,
+small EEPROM backed file). At start copies and logs are compared with majority voting
+*/
+
+package timegopher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+//BootCounterStore keeps copy of boot counter. FileBootCounter is implementation
+type BootCounterStore interface {
+	ReadBootCounter() (int32, error)
+	WriteBootCounter(boot int32) error
+}
+
+//boot(4)+crc32(4)
+const BOOTCOUNTER_FILESIZE = 8
+
+type FileBootCounter struct {
+	Filename string
+}
+
+func (p *FileBootCounter) String() string {
+	return p.Filename
+}
+
+func (p *FileBootCounter) ReadBootCounter() (int32, error) {
+	raw, errRead := os.ReadFile(p.Filename)
+	if errRead != nil {
+		return 0, errRead
+	}
+	if len(raw) != BOOTCOUNTER_FILESIZE {
+		return 0, fmt.Errorf("invalid boot counter size %v on %s", len(raw), p.Filename)
+	}
+	if crc32.ChecksumIEEE(raw[0:4]) != binary.LittleEndian.Uint32(raw[4:8]) {
+		return 0, fmt.Errorf("boot counter crc error on %s", p.Filename)
+	}
+	return int32(binary.LittleEndian.Uint32(raw[0:4])), nil
+}
+
+func (p *FileBootCounter) WriteBootCounter(boot int32) error {
+	raw := make([]byte, BOOTCOUNTER_FILESIZE)
+	binary.LittleEndian.PutUint32(raw[0:4], uint32(boot))
+	binary.LittleEndian.PutUint32(raw[4:8], crc32.ChecksumIEEE(raw[0:4]))
+	return writeFileSync(p.Filename, raw)
+}
+
+const BOOTVOTE_LOGS = "logs"
+
+//BootVote is boot number from one source. Source is BOOTVOTE_LOGS or name of store (String() or index)
+type BootVote struct {
+	Source string
+	Boot   int32
+	Err    error //Store could not be read (not counted) or updated
+}
+
+type BootVoteResult struct {
+	Boot   int32 //Boot number with most votes, never less than logs. Higher wins on tie, so boot numbers are not reused
+	Votes  []BootVote
+	Agreed bool //All sources were readable and had same boot number
+}
+
+//Disagreements lists votes that failed or differ from result
+func (p *BootVoteResult) Disagreements() []BootVote {
+	result := []BootVote{}
+	for _, v := range p.Votes {
+		if v.Err != nil || v.Boot != p.Boot {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func bootStoreName(store BootCounterStore, index int) string {
+	named, isNamed := store.(fmt.Stringer)
+	if isNamed {
+		return named.String()
+	}
+	return fmt.Sprintf("store%v", index)
+}
+
+/*
+VoteBootNumber compares boot number from logs and stores with majority voting.
+Logs already have entries on their boot number, so stale stores can only raise the result. Lower majority is reported as disagreement
+*/
+func VoteBootNumber(fromLogs int32, stores []BootCounterStore) BootVoteResult {
+	result := BootVoteResult{Votes: []BootVote{{Source: BOOTVOTE_LOGS, Boot: fromLogs}}, Agreed: true}
+	for i, store := range stores {
+		boot, err := store.ReadBootCounter()
+		result.Votes = append(result.Votes, BootVote{Source: bootStoreName(store, i), Boot: boot, Err: err})
+	}
+
+	counts := make(map[int32]int)
+	for _, v := range result.Votes {
+		if v.Err == nil {
+			counts[v.Boot]++
+		}
+	}
+	candidates := []int32{}
+	for boot := range counts {
+		candidates = append(candidates, boot)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if counts[candidates[i]] != counts[candidates[j]] {
+			return counts[candidates[i]] > counts[candidates[j]]
+		}
+		return candidates[i] > candidates[j]
+	})
+	result.Boot = max(fromLogs, candidates[0]) //At least logs is counted
+	result.Agreed = len(result.Disagreements()) == 0
+	return result
+}
+
+//BootCounterVote is result of boot counter voting at Init. Empty if BootCounters were not set
+func (p *TimeGopher) BootCounterVote() BootVoteResult {
+	return p.bootVote
+}
+
+//writeBootCounters updates stores that do not have current boot number. Failing store does not prevent start, error is reported on vote
+func (p *TimeGopher) writeBootCounters(stores []BootCounterStore) {
+	for i, store := range stores {
+		vote := &p.bootVote.Votes[i+1]
+		if vote.Err == nil && vote.Boot == p.bootNumber {
+			continue
+		}
+		errWrite := store.WriteBootCounter(p.bootNumber)
+		if errWrite != nil {
+			vote.Err = fmt.Errorf("writing boot counter to %s failed err=%v", vote.Source, errWrite)
+			p.bootVote.Agreed = false
+		}
+	}
+}
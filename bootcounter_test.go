@@ -0,0 +1,108 @@
+package timegopher
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBootCounter struct {
+	boot    int32
+	err     error
+	written int
+}
+
+func (p *testBootCounter) ReadBootCounter() (int32, error) {
+	return p.boot, p.err
+}
+
+func (p *testBootCounter) WriteBootCounter(boot int32) error {
+	p.boot = boot
+	p.written++
+	return nil
+}
+
+func TestVoteBootNumber(t *testing.T) {
+	result := VoteBootNumber(5, []BootCounterStore{&testBootCounter{boot: 5}, &testBootCounter{boot: 5}})
+	assert.Equal(t, int32(5), result.Boot)
+	assert.Equal(t, true, result.Agreed)
+	assert.Equal(t, 0, len(result.Disagreements()))
+
+	//Logs lost
+	result = VoteBootNumber(0, []BootCounterStore{&testBootCounter{boot: 12}, &testBootCounter{boot: 12}})
+	assert.Equal(t, int32(12), result.Boot)
+	assert.Equal(t, false, result.Agreed)
+	assert.Equal(t, []BootVote{{Source: BOOTVOTE_LOGS, Boot: 0}}, result.Disagreements())
+
+	//Tie, higher wins. Failed store is not counted
+	errRead := fmt.Errorf("crc error")
+	result = VoteBootNumber(3, []BootCounterStore{&testBootCounter{boot: 4}, &testBootCounter{boot: 4, err: errRead}})
+	assert.Equal(t, int32(4), result.Boot)
+	assert.Equal(t, []BootVote{{Source: BOOTVOTE_LOGS, Boot: 3}, {Source: "store1", Boot: 4, Err: errRead}}, result.Disagreements())
+
+	//Stale majority can not go below logs
+	result = VoteBootNumber(6, []BootCounterStore{&testBootCounter{boot: 4}, &testBootCounter{boot: 4}})
+	assert.Equal(t, int32(6), result.Boot)
+	assert.Equal(t, false, result.Agreed)
+	assert.Equal(t, []BootVote{{Source: "store0", Boot: 4}, {Source: "store1", Boot: 4}}, result.Disagreements())
+}
+
+func TestBootCounterStale(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tPrev := time.Unix(0, TESTEPOCH0)
+	assert.Equal(t, nil, rtc.Insert(TimeVariable{BootNumber: 6, Uptime: 1000, Epoch: NsEpoch(tPrev.UnixNano())}))
+	assert.Equal(t, nil, last.Insert(TimeVariable{BootNumber: 6, Uptime: 5000}))
+
+	first := testBootCounter{boot: 4}
+	second := testBootCounter{boot: 4}
+	tNow := tPrev.Add(time.Hour)
+	conf := TimeGopherConf{TimeNow: tNow, ColdStart: true, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last, UptimeCheck: testUptimeChecker(tNow, 1000), BootCounters: []BootCounterStore{&first, &second}}
+	g, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+	tv, _ := g.Convert(tNow)
+	assert.Equal(t, int32(7), tv.BootNumber)
+	vote := g.BootCounterVote()
+	assert.Equal(t, int32(6), vote.Boot)
+	assert.Equal(t, 2, len(vote.Disagreements()))
+	assert.Equal(t, int32(7), first.boot)
+	assert.Equal(t, int32(7), second.boot)
+}
+
+func TestFileBootCounter(t *testing.T) {
+	dir := t.TempDir()
+	dut := FileBootCounter{Filename: path.Join(dir, "bootcounter")}
+	_, errRead := dut.ReadBootCounter()
+	assert.NotEqual(t, nil, errRead)
+	assert.Equal(t, nil, dut.WriteBootCounter(42))
+	boot, errRead := dut.ReadBootCounter()
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, int32(42), boot)
+
+	raw, _ := os.ReadFile(dut.Filename)
+	raw[0]++
+	os.WriteFile(dut.Filename, raw, 0666)
+	_, errRead = dut.ReadBootCounter()
+	assert.NotEqual(t, nil, errRead)
+
+	//Logs are lost, counters keep numbering. Corrupted copy is fixed
+	second := testBootCounter{boot: 42}
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	conf := TimeGopherConf{TimeNow: tNow, ColdStart: true, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last, UptimeCheck: testUptimeChecker(tNow, 1000), BootCounters: []BootCounterStore{&dut, &second}}
+	g, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+	tv, _ := g.Convert(tNow)
+	assert.Equal(t, int32(43), tv.BootNumber)
+	vote := g.BootCounterVote()
+	assert.Equal(t, int32(42), vote.Boot)
+	assert.Equal(t, false, vote.Agreed)
+	assert.Equal(t, 2, len(vote.Disagreements()))
+	boot, errRead = dut.ReadBootCounter()
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, int32(43), boot)
+	assert.Equal(t, int32(43), second.boot)
+}
@@ -0,0 +1,126 @@
+/*
+Clock adjuster
+
+SetSysClock steps clock and every step creates discontinuity on wall clock data of other processes.
+ClockAdjuster slews small offsets with adjtimex ADJ_OFFSET (kernel PLL) and steps only if offset is over threshold.
+Backward step past latest known epoch on sync logs is refused unless AllowBackwardStep is set.
+Steps are recorded to ClockEventLog of TimeGopher
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// https://man7.org/linux/man-pages/man2/adjtimex.2.html
+const (
+	ADJ_OFFSET = 0x0001
+	ADJ_STATUS = 0x0010
+	ADJ_NANO   = 0x2000
+)
+
+//Kernel PLL accepts offsets up to 0.5s. ntpd uses same default step threshold
+const CLOCKADJUSTER_DEFAULTSTEPTHRESHOLD = 128 * time.Millisecond
+
+type ClockAction int
+
+const (
+	CLOCKACTION_NONE ClockAction = iota
+	CLOCKACTION_SLEW
+	CLOCKACTION_STEP
+)
+
+//ClockSyscalls are operations done to system clock. LinuxClockSyscalls is real implementation
+type ClockSyscalls interface {
+	Now() time.Time
+	Slew(offset time.Duration) error
+	Step(t time.Time) error
+}
+
+type LinuxClockSyscalls struct{}
+
+//setTimexValue sets Timex field that is int32 or int64 depending on architecture
+func setTimexValue[T int32 | int64](dst *T, v int64) {
+	*dst = T(v)
+}
+
+func (p *LinuxClockSyscalls) Now() time.Time {
+	return time.Now()
+}
+
+//Slew gives offset to kernel PLL. PLL and nanosecond mode are enabled on current status, other bits (STA_UNSYNC, leap) are kept
+func (p *LinuxClockSyscalls) Slew(offset time.Duration) error {
+	current := syscall.Timex{} //Modes 0 is read only
+	_, errRead := syscall.Adjtimex(&current)
+	if errRead != nil {
+		return fmt.Errorf("reading clock status failed err=%v", errRead)
+	}
+	tx := syscall.Timex{Modes: ADJ_OFFSET | ADJ_NANO | ADJ_STATUS}
+	setTimexValue(&tx.Offset, int64(offset))
+	setTimexValue(&tx.Status, int64(current.Status)|STA_PLL|STA_NANO)
+	_, err := syscall.Adjtimex(&tx)
+	return err
+}
+
+func (p *LinuxClockSyscalls) Step(t time.Time) error {
+	return SetSysClock(t)
+}
+
+type ClockAdjuster struct {
+	Gopher            *TimeGopher
+	Sys               ClockSyscalls //Default LinuxClockSyscalls
+	StepThreshold     time.Duration //Default CLOCKADJUSTER_DEFAULTSTEPTHRESHOLD
+	AllowBackwardStep bool          //Allow stepping before latest known epoch
+}
+
+func (p *ClockAdjuster) sys() ClockSyscalls {
+	if p.Sys == nil {
+		return &LinuxClockSyscalls{}
+	}
+	return p.Sys
+}
+
+//Adjust corrects system clock by offset (correct time - system clock)
+func (p *ClockAdjuster) Adjust(offset time.Duration) (ClockAction, error) {
+	sys := p.sys()
+	threshold := p.StepThreshold
+	if threshold <= 0 {
+		threshold = CLOCKADJUSTER_DEFAULTSTEPTHRESHOLD
+	}
+	if offset == 0 {
+		return CLOCKACTION_NONE, nil
+	}
+	if -threshold < offset && offset < threshold {
+		return CLOCKACTION_SLEW, sys.Slew(offset)
+	}
+
+	before := sys.Now()
+	after := before.Add(offset)
+	if offset < 0 && !p.AllowBackwardStep {
+		latest, errLatest := p.Gopher.latestKnownEpoch(TimeVariable{})
+		if errLatest != nil {
+			return CLOCKACTION_NONE, errLatest
+		}
+		if NsEpoch(after.UnixNano()) < latest {
+			return CLOCKACTION_NONE, fmt.Errorf("refusing to step clock back to %v, latest known time is %v", after, time.Unix(0, int64(latest)))
+		}
+	}
+	tv, errConvert := p.Gopher.Convert(before)
+	if errConvert != nil {
+		return CLOCKACTION_NONE, errConvert
+	}
+	errStep := sys.Step(after)
+	if errStep != nil {
+		return CLOCKACTION_NONE, fmt.Errorf("stepping clock failed err=%v", errStep)
+	}
+	if p.Gopher.ClockEventLog != nil {
+		errLog := p.Gopher.ClockEventLog.Insert(ClockEvent{Kind: CLOCKEVENT_STEP, BootNumber: tv.BootNumber, Uptime: tv.Uptime, Before: NsEpoch(before.UnixNano()), After: NsEpoch(after.UnixNano())})
+		if errLog != nil {
+			return CLOCKACTION_STEP, fmt.Errorf("clock stepped but recording failed err=%v", errLog)
+		}
+	}
+	return CLOCKACTION_STEP, nil
+}
@@ -0,0 +1,110 @@
+package timegopher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClockSyscalls struct {
+	now     time.Time
+	slewed  []time.Duration
+	stepped []time.Time
+	err     error
+}
+
+func (p *testClockSyscalls) Now() time.Time {
+	return p.now
+}
+
+func (p *testClockSyscalls) Slew(offset time.Duration) error {
+	p.slewed = append(p.slewed, offset)
+	return p.err
+}
+
+func (p *testClockSyscalls) Step(t time.Time) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.stepped = append(p.stepped, t)
+	p.now = t
+	return nil
+}
+
+func TestClockEventBinary(t *testing.T) {
+	e := ClockEvent{Kind: CLOCKEVENT_STEP, BootNumber: 3, Uptime: 12345, Before: TESTEPOCH0, After: TESTEPOCH0 - 1000}
+	bin, errBin := e.ToBinary()
+	assert.Equal(t, nil, errBin)
+	assert.Equal(t, RECORDSIZE_CLOCKEVENT, len(bin))
+	parsed, errParse := ParseClockEvent(bin)
+	assert.Equal(t, nil, errParse)
+	assert.Equal(t, e, parsed)
+	assert.Equal(t, NsEpoch(-1000), parsed.Change())
+
+	_, errBin = (&ClockEvent{}).ToBinary()
+	assert.NotEqual(t, nil, errBin)
+}
+
+func TestClockAdjuster(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_CLOCKEVENT, MaxRecords: 16}
+	memsto, errMem := memconf.InitMemLoop()
+	assert.Equal(t, nil, errMem)
+	events, errEvents := CreateClockEventDb(&memsto)
+	assert.Equal(t, nil, errEvents)
+	g.ClockEventLog = &events
+
+	sys := testClockSyscalls{now: tNow}
+	dut := ClockAdjuster{Gopher: &g, Sys: &sys}
+
+	action, err := dut.Adjust(0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, CLOCKACTION_NONE, action)
+
+	//Small offsets are slewed
+	action, err = dut.Adjust(-50 * time.Millisecond)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, CLOCKACTION_SLEW, action)
+	assert.Equal(t, []time.Duration{-50 * time.Millisecond}, sys.slewed)
+	assert.Equal(t, 0, len(sys.stepped))
+
+	//Large offset is stepped and recorded
+	action, err = dut.Adjust(time.Hour)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, CLOCKACTION_STEP, action)
+	assert.Equal(t, []time.Time{tNow.Add(time.Hour)}, sys.stepped)
+	all, _ := events.All()
+	assert.Equal(t, 1, len(all))
+	assert.Equal(t, CLOCKEVENT_STEP, all[0].Kind)
+	assert.Equal(t, int32(1), all[0].BootNumber)
+	assert.Equal(t, NsEpoch(tNow.UnixNano()), all[0].Before)
+	assert.Equal(t, NsEpoch(tNow.Add(time.Hour).UnixNano()), all[0].After)
+
+	//Certain sync after step, backward step past it is refused
+	assert.Equal(t, nil, g.Refresh(sys.now, true))
+	action, err = dut.Adjust(-2 * time.Second)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, CLOCKACTION_NONE, action)
+	assert.Equal(t, 1, len(sys.stepped))
+
+	dut.AllowBackwardStep = true
+	action, err = dut.Adjust(-2 * time.Second)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, CLOCKACTION_STEP, action)
+	all, _ = events.All()
+	assert.Equal(t, 2, len(all))
+	assert.Equal(t, NsEpoch(-2*time.Second), all[1].Change())
+
+	//Failing syscall is not recorded
+	sys.err = fmt.Errorf("operation not permitted")
+	_, err = dut.Adjust(time.Hour)
+	assert.NotEqual(t, nil, err)
+	all, _ = events.All()
+	assert.Equal(t, 2, len(all))
+}
@@ -0,0 +1,118 @@
+/*
+Clock event log
+
+Records events where wall clock changed: steps done by ClockAdjuster and jumps detected on refresh.
+Each event have uptime and epoch before and after change
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hjkoskel/fixregsto"
+)
+
+type ClockEventKind uint8
+
+const (
+	CLOCKEVENT_STEP         ClockEventKind = iota + 1 //ClockAdjuster stepped clock
+	CLOCKEVENT_JUMPFORWARD                            //Detected on refresh, wall clock moved more than uptime
+	CLOCKEVENT_JUMPBACKWARD                           //Detected on refresh, wall clock moved less than uptime or backwards
+)
+
+//ClockEvent tells that wall clock changed from Before to After at boot and uptime
+type ClockEvent struct {
+	Kind       ClockEventKind
+	BootNumber int32
+	Uptime     NsUptime
+	Before     NsEpoch
+	After      NsEpoch
+}
+
+//kind(1)+reserved(3)+boot(4)+uptime(8)+before(8)+after(8)
+const RECORDSIZE_CLOCKEVENT = 32
+
+//Change is size of change, negative if clock went backwards
+func (p *ClockEvent) Change() NsEpoch {
+	return p.After - p.Before
+}
+
+func (p *ClockEvent) ToBinary() ([]byte, error) {
+	if p.Kind == 0 {
+		return nil, fmt.Errorf("clock event kind missing")
+	}
+	if p.BootNumber < 0 || p.Uptime < 0 {
+		return nil, fmt.Errorf("invalid clock event boot %v uptime %v", p.BootNumber, p.Uptime)
+	}
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{byte(p.Kind), 0, 0, 0})
+	binary.Write(buf, binary.LittleEndian, p.BootNumber)
+	binary.Write(buf, binary.LittleEndian, p.Uptime)
+	binary.Write(buf, binary.LittleEndian, p.Before)
+	binary.Write(buf, binary.LittleEndian, p.After)
+	return buf.Bytes(), nil
+}
+
+func ParseClockEvent(raw []byte) (ClockEvent, error) {
+	if len(raw) != RECORDSIZE_CLOCKEVENT {
+		return ClockEvent{}, fmt.Errorf("invalid size %v for clock event", len(raw))
+	}
+	return ClockEvent{
+		Kind:       ClockEventKind(raw[0]),
+		BootNumber: int32(binary.LittleEndian.Uint32(raw[4:8])),
+		Uptime:     NsUptime(binary.LittleEndian.Uint64(raw[8:16])),
+		Before:     NsEpoch(binary.LittleEndian.Uint64(raw[16:24])),
+		After:      NsEpoch(binary.LittleEndian.Uint64(raw[24:32])),
+	}, nil
+}
+
+//ClockEventLog stores ClockEvents. ClockEventDb is implementation on fixregsto
+type ClockEventLog interface {
+	Insert(e ClockEvent) error
+	All() ([]ClockEvent, error)
+}
+
+type ClockEventDb struct {
+	sto fixregsto.FixRegSto
+	mem []ClockEvent
+}
+
+//CreateClockEventDb restores content from FixRegSto storage (RecordSize RECORDSIZE_CLOCKEVENT)
+func CreateClockEventDb(storage fixregsto.FixRegSto) (ClockEventDb, error) {
+	raw, readErr := storage.ReadAll()
+	if readErr != nil {
+		return ClockEventDb{}, fmt.Errorf("error on ReadAll on CreateClockEventDb err=%v", readErr.Error())
+	}
+	if len(raw)%RECORDSIZE_CLOCKEVENT != 0 {
+		return ClockEventDb{}, fmt.Errorf("must be multiple of %v (len=%v)", RECORDSIZE_CLOCKEVENT, len(raw))
+	}
+	result := ClockEventDb{sto: storage, mem: make([]ClockEvent, len(raw)/RECORDSIZE_CLOCKEVENT)}
+	for i := range result.mem {
+		var errParse error
+		result.mem[i], errParse = ParseClockEvent(raw[i*RECORDSIZE_CLOCKEVENT : (i+1)*RECORDSIZE_CLOCKEVENT])
+		if errParse != nil {
+			return result, errParse
+		}
+	}
+	return result, nil
+}
+
+func (p *ClockEventDb) Insert(e ClockEvent) error {
+	binarr, errBin := e.ToBinary()
+	if errBin != nil {
+		return fmt.Errorf("Insert error, binary coding %#v failed %v", e, errBin)
+	}
+	_, errWrite := p.sto.Write(binarr)
+	if errWrite != nil {
+		return errWrite
+	}
+	p.mem = append(p.mem, e)
+	return nil
+}
+
+func (p *ClockEventDb) All() ([]ClockEvent, error) {
+	return p.mem, nil
+}
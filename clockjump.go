@@ -0,0 +1,80 @@
+/*
+Wall clock jump detection
+
+Between refreshes wall clock should advance as much as uptime. Difference tells that something (ntpdate, user,
+buggy RTC driver, ClockAdjuster) stepped the clock. Jumps are recorded to JumpLog so gaps and overlaps on
+application data can be explained later
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"time"
+)
+
+const JUMPDETECT_DEFAULTTHRESHOLD NsEpoch = 1000 * 1000 * 1000
+
+//Kernel slews at most 500ppm. Slewing is not a jump
+const JUMPDETECT_MAXSLEWPPM = 500
+
+//initJumpRef sets reference for first refresh at init. On warm start latest alive entry of same boot is used if it
+//have epoch (LastLog stores RTC), so jump while software was not running is detected. Epoch of alive entry have offset
+//of RefreshWithOffset, so after run using offset, offset change is detected as jump
+func (p *TimeGopher) initJumpRef(t time.Time, uptime NsUptime) error {
+	p.jumpRef = TimeVariable{BootNumber: p.bootNumber, Uptime: uptime, Epoch: NsEpoch(t.UnixNano())}
+	if p.LastLog == nil {
+		return nil
+	}
+	arr, errLast := p.LastLog.GetLatestN(1)
+	if errLast != nil {
+		return errLast
+	}
+	if 0 < len(arr) && arr[0].BootNumber == p.bootNumber && arr[0].Epoch != 0 && arr[0].Uptime <= uptime {
+		p.jumpRef = arr[0]
+	}
+	return nil
+}
+
+//detectJump compares wall clock delta against uptime delta since previous refresh. Epoch of now is system clock without offset
+func (p *TimeGopher) detectJump(now TimeVariable) error {
+	ref := p.jumpRef
+	p.jumpRef = now
+	if p.JumpLog == nil || ref.BootNumber != now.BootNumber || ref.Epoch == 0 {
+		return nil
+	}
+	uptimeDelta := now.Uptime - ref.Uptime
+	expected := ref.Epoch + NsEpoch(uptimeDelta)
+	jump := now.Epoch - expected
+	limit := p.JumpThreshold + NsEpoch(uptimeDelta/1000000*JUMPDETECT_MAXSLEWPPM)
+	if -limit < jump && jump < limit {
+		return nil
+	}
+	kind := CLOCKEVENT_JUMPFORWARD
+	if jump < 0 {
+		kind = CLOCKEVENT_JUMPBACKWARD
+	}
+	errInsert := p.JumpLog.Insert(ClockEvent{Kind: kind, BootNumber: now.BootNumber, Uptime: now.Uptime, Before: expected, After: now.Epoch})
+	if errInsert != nil {
+		return fmt.Errorf("recording clock jump %v failed err=%v", jump, errInsert)
+	}
+	return nil
+}
+
+//Jumps returns all jumps detected at boot
+func (p *TimeGopher) Jumps(boot int32) ([]ClockEvent, error) {
+	result := []ClockEvent{}
+	if p.JumpLog == nil {
+		return result, nil
+	}
+	all, err := p.JumpLog.All()
+	if err != nil {
+		return result, err
+	}
+	for _, e := range all {
+		if e.BootNumber == boot {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
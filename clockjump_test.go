@@ -0,0 +1,87 @@
+package timegopher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJumpDetect(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_CLOCKEVENT, MaxRecords: 16}
+	memsto, errMem := memconf.InitMemLoop()
+	assert.Equal(t, nil, errMem)
+	jumps, errJumps := CreateClockEventDb(&memsto)
+	assert.Equal(t, nil, errJumps)
+
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	conf := TimeGopherConf{TimeNow: tNow, ColdStart: true, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last, UptimeCheck: testUptimeChecker(tNow, 1000), JumpLog: &jumps}
+	dut, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+
+	//Wall clock and uptime advance together
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(time.Minute), false))
+	all, _ := jumps.All()
+	assert.Equal(t, 0, len(all))
+
+	//Clock stepped one hour forward 10 seconds after previous refresh
+	dut.UptimeCheck = testUptimeChecker(tNow.Add(time.Hour), 1000)
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(time.Hour+70*time.Second), true))
+	all, _ = jumps.All()
+	assert.Equal(t, 1, len(all))
+	assert.Equal(t, CLOCKEVENT_JUMPFORWARD, all[0].Kind)
+	assert.Equal(t, int32(1), all[0].BootNumber)
+	assert.Equal(t, 1000+NsUptime(70*time.Second), all[0].Uptime)
+	assert.Equal(t, NsEpoch(time.Hour), all[0].Change())
+
+	//Small slew is not a jump
+	dut.UptimeCheck = testUptimeChecker(tNow.Add(time.Hour+100*time.Millisecond), 1000)
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(time.Hour+80*time.Second+100*time.Millisecond), true))
+	all, _ = jumps.All()
+	assert.Equal(t, 1, len(all))
+
+	//Back 30 minutes while not synced
+	dut.UptimeCheck = testUptimeChecker(tNow.Add(30*time.Minute+100*time.Millisecond), 1000)
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(30*time.Minute+90*time.Second+100*time.Millisecond), false))
+	found, errFound := dut.Jumps(1)
+	assert.Equal(t, nil, errFound)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, CLOCKEVENT_JUMPBACKWARD, found[1].Kind)
+	assert.Equal(t, NsEpoch(-30*time.Minute), found[1].Change())
+
+	found, _ = dut.Jumps(2)
+	assert.Equal(t, 0, len(found))
+}
+
+func TestJumpDetectWarmStart(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_CLOCKEVENT, MaxRecords: 16}
+	memsto, _ := memconf.InitMemLoop()
+	jumps, _ := CreateClockEventDb(&memsto)
+
+	rtc, uncertain, start, stop, _ := testMemLogs()
+	aliveDb := CreateTimeMemDb(true)
+	last := &aliveDb
+	tNow := time.Unix(0, TESTEPOCH0)
+	conf := TimeGopherConf{TimeNow: tNow, ColdStart: true, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last, UptimeCheck: testUptimeChecker(tNow, 1000), JumpLog: &jumps}
+	_, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+	all, _ := jumps.All()
+	assert.Equal(t, 0, len(all))
+
+	//Software restarted one minute later, clock was stepped one hour forward while not running
+	conf.ColdStart = false
+	conf.TimeNow = tNow.Add(time.Hour + time.Minute)
+	conf.UptimeCheck = testUptimeChecker(conf.TimeNow, 1000+NsUptime(time.Minute))
+	dut, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+	found, _ := dut.Jumps(1)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, NsEpoch(time.Hour), found[0].Change())
+
+	//Reference is kept after init
+	assert.Equal(t, nil, dut.Refresh(conf.TimeNow.Add(time.Second), false))
+	found, _ = dut.Jumps(1)
+	assert.Equal(t, 1, len(found))
+}
@@ -0,0 +1,88 @@
+/*
+Retroactive corrections
+
+If clock was set wrong (like DoUncertainTimeSync by operator) and certain sync arrives later on same boot, data
+timestamped in between was converted with wrong epoch. Uptime is continuous within boot, so certain sync tells
+correct epoch also backwards. EpochCorrection tells how much epoch values on uptime range must be corrected
+*/
+
+package timegopher
+
+import (
+	"fmt"
+)
+
+type EpochCorrection struct {
+	BootNumber int32
+	From       NsUptime     //Start of uptime range, 0 for range before first uncertain sync
+	To         NsUptime     //End of range (not included)
+	Uncertain  TimeVariable //Uncertain sync entry used for range
+	Correction NsEpoch      //Add to epoch values converted on range
+}
+
+/*
+SolveCorrections solves corrections for uncertain syncs before certain sync on same boot.
+Only uncertain syncs made after previous certain sync of boot are used. Ranges without correction are not listed
+*/
+func (p *TimeGopher) SolveCorrections(certain TimeVariable) ([]EpochCorrection, error) {
+	result := []EpochCorrection{}
+	if p.UncertainRtcSyncLog == nil {
+		return result, nil
+	}
+	arr, errArr := p.UncertainRtcSyncLog.GetOnBoot(certain.BootNumber)
+	if errArr != nil {
+		return result, fmt.Errorf("getting uncertain syncs of boot %v failed err=%v", certain.BootNumber, errArr)
+	}
+	certainArr, errCertain := p.RtcSyncLog.GetOnBoot(certain.BootNumber)
+	if errCertain != nil {
+		return result, fmt.Errorf("getting certain syncs of boot %v failed err=%v", certain.BootNumber, errCertain)
+	}
+	hasPrevious := false
+	previous := NsUptime(0) //Previous certain sync of boot
+	for _, c := range certainArr {
+		if c.Uptime < certain.Uptime {
+			previous = c.Uptime
+			hasPrevious = true
+		}
+	}
+
+	correctBase := certain.Epoch - NsEpoch(certain.Uptime) //Epoch at uptime 0
+	first := true
+	for i, uc := range arr {
+		if certain.Uptime <= uc.Uptime {
+			break
+		}
+		if hasPrevious && uc.Uptime <= previous {
+			continue
+		}
+		c := EpochCorrection{BootNumber: certain.BootNumber, From: uc.Uptime, To: certain.Uptime, Uncertain: uc}
+		if first && !hasPrevious {
+			c.From = 0
+		}
+		first = false
+		if i+1 < len(arr) && arr[i+1].Uptime < certain.Uptime {
+			c.To = arr[i+1].Uptime
+		}
+		c.Correction = correctBase - (uc.Epoch - NsEpoch(uc.Uptime))
+		if c.Correction != 0 {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+//insertCertainSync inserts certain sync. Corrections for uncertain syncs made after previous certain sync of boot are passed to OnCorrection
+func (p *TimeGopher) insertCertainSync(tv TimeVariable, meta SyncMeta) error {
+	errInsert := p.insertSync(tv, true, meta)
+	if errInsert != nil || p.OnCorrection == nil {
+		return errInsert
+	}
+	corrections, errSolve := p.SolveCorrections(tv)
+	if errSolve != nil {
+		return errSolve
+	}
+	if 0 < len(corrections) {
+		p.OnCorrection(corrections)
+	}
+	return nil
+}
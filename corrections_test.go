@@ -0,0 +1,67 @@
+package timegopher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrections(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	reported := [][]EpochCorrection{}
+	conf := TimeGopherConf{TimeNow: tNow, ColdStart: true, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last, UptimeCheck: testUptimeChecker(tNow, 1000),
+		OnCorrection: func(corrections []EpochCorrection) { reported = append(reported, corrections) }}
+	dut, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+
+	//Operator sets clock one day ahead
+	day := 24 * time.Hour
+	dut.UptimeCheck = testUptimeChecker(tNow.Add(day), 1000)
+	assert.Equal(t, nil, dut.DoUncertainTimeSync(tNow.Add(day+10*time.Second)))
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(day+20*time.Second), false))
+	assert.Equal(t, 0, len(reported))
+
+	//NTP fixes clock
+	dut.UptimeCheck = testUptimeChecker(tNow, 1000)
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(60*time.Second), true))
+	assert.Equal(t, 1, len(reported))
+	assert.Equal(t, []EpochCorrection{{
+		BootNumber: 1,
+		From:       1000 + NsUptime(10*time.Second),
+		To:         1000 + NsUptime(60*time.Second),
+		Uncertain:  TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(10*time.Second), Epoch: NsEpoch(tNow.Add(day + 10*time.Second).UnixNano())},
+		Correction: -NsEpoch(day),
+	}}, reported[0])
+
+	//Correct value for timestamp converted with bad sync
+	wrong := NsEpoch(tNow.Add(day + 30*time.Second).UnixNano())
+	assert.Equal(t, NsEpoch(tNow.Add(30*time.Second).UnixNano()), wrong+reported[0][0].Correction)
+
+	//No uncertain syncs after previous certain sync, nothing to report
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(70*time.Second), false))
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(80*time.Second), true))
+	assert.Equal(t, 1, len(reported))
+
+	//Same can be solved later
+	certain, _ := rtc.GetFirstN(1)
+	corrections, errSolve := dut.SolveCorrections(certain[0])
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, reported[0], corrections)
+
+	//NTP lost and operator sets clock wrong again. NTP comes back on same boot
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(90*time.Second), false))
+	dut.UptimeCheck = testUptimeChecker(tNow.Add(day), 1000)
+	assert.Equal(t, nil, dut.DoUncertainTimeSync(tNow.Add(day+100*time.Second)))
+	dut.UptimeCheck = testUptimeChecker(tNow, 1000)
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(150*time.Second), true))
+	assert.Equal(t, 2, len(reported))
+	assert.Equal(t, []EpochCorrection{{
+		BootNumber: 1,
+		From:       1000 + NsUptime(100*time.Second),
+		To:         1000 + NsUptime(150*time.Second),
+		Uncertain:  TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(100*time.Second), Epoch: NsEpoch(tNow.Add(day + 100*time.Second).UnixNano())},
+		Correction: -NsEpoch(day),
+	}}, reported[1])
+}
@@ -30,156 +30,152 @@ const (
 	RECORDSIZE_TIMEVARIABLE_RTC   = 20
 )
 
+const DEFAULTJOURNALNAME = "time.journal"
+
 /*
 Create default that is good for embedded linux use
 This function acts also as example use
 Not possible to unit test well.
 */
 func CreateDefaultTimeGopher(rtcLogDir string, latestKnowTimeElsewhere TimeVariable) (TimeGopher, error) {
-	var errDisk error
-
 	inSync, errInSync := RtcIsSynced_adjtimex()
 	if errInSync != nil {
 		return TimeGopher{}, fmt.Errorf("checking rtc sync error= %v", errInSync)
 	}
 
-	//var uncertainRtcSyncLog, rtcSyncLog, startupLog, lastLog, volatileAlive, nonVoltatileAlive InDiskDb
-
-	var uncertainRtcLog, rtcLog, startLog, stopLog, lastLog TimeFileDb
-
 	firstRunAfterBoot, errFirstRunAfterBoot := FirstCallAfterBoot(WARMSTARTFILE)
 	if errFirstRunAfterBoot != nil {
 		return TimeGopher{}, fmt.Errorf("FirstCallAfterBoot:%v", errFirstRunAfterBoot)
 	}
 
-	/*DEFAULTDBFILE_UNCERTAINRTC = "uncertain.rtc"
-	DEFAULTDBFILE_RTC = "rtcsync.rtc"
-
-	DEFAULTDBFILE_STARTUPLOG = "startup.time"
-	DEFAULTDBFILE_ALIVELOG = "alive.time"
-	*/
-
-	/*
-		Uncertain RTC.
-		When user syncs or some unreliable source  "better than nothing"
-	*/
-	confUncertainRtc := fixregsto.FileStorageConf{
-		Name:         DEFAULTDBFILE_UNCERTAINRTC,
-		RecordSize:   RECORDSIZE_TIMEVARIABLE_RTC,
-		MaxFileCount: 256,
-		FileMaxSize:  512 * 4,
-		Path:         rtcLogDir,
-	}
-
-	stoUncertainRtc, errUncertainRtc := confUncertainRtc.InitFileStorage()
-	if errUncertainRtc != nil {
-		return TimeGopher{}, fmt.Errorf("UncertainRtc init error %v", errUncertainRtc)
-	}
-	uncertainRtcLog, errDisk = CreateTimeFileDb(&stoUncertainRtc, true)
+	logs, errDisk := openLogDir(rtcLogDir)
 	if errDisk != nil {
-		return TimeGopher{}, fmt.Errorf("UncertainRTC create error %v", errDisk)
-	}
-
-	/*
-		Good sync from good clock source (NTP etc...)
-	*/
-	confRtc := fixregsto.FileStorageConf{
-		Name:         DEFAULTDBFILE_RTC,
-		RecordSize:   RECORDSIZE_TIMEVARIABLE_RTC,
-		MaxFileCount: 256,
-		FileMaxSize:  512 * 4,
-		Path:         rtcLogDir,
+		return TimeGopher{}, errDisk
 	}
 
-	stoRtc, errRtc := confRtc.InitFileStorage()
-	if errRtc != nil {
-		return TimeGopher{}, fmt.Errorf("rtc sync init err %v", errRtc)
-	}
-	rtcLog, errDisk = CreateTimeFileDb(&stoRtc, true)
-	if errDisk != nil {
-		return TimeGopher{}, fmt.Errorf("rtc create error %v", errDisk)
+	uptimeCheck, errCreateUptimeChecker := CreateUptimeChecker()
+	if errCreateUptimeChecker != nil {
+		return TimeGopher{}, errCreateUptimeChecker
 	}
 
-	/*
-		Start log,
-
-		Updated when program starts (copies previous alive)
-	*/
-	confStart := fixregsto.FileStorageConf{
-		Name:         DEFAULTDBFILE_STARTLOG,
-		RecordSize:   RECORDSIZE_TIMEVARIABLE_NORTC,
-		MaxFileCount: 256,
-		FileMaxSize:  512 * 4,
-		Path:         rtcLogDir,
+	hwRtc := CreateHwRtc()
+	conf := TimeGopherConf{
+		TimeNow:   time.Now(),
+		InSync:    inSync,
+		ColdStart: firstRunAfterBoot,
+		//These have RTC time
+		RtcSyncLog:              logs[LOGNAME_RTC],
+		UncertainRtcSyncLog:     logs[LOGNAME_UNCERTAINRTC],
+		StartLog:                logs[LOGNAME_START],
+		StopLog:                 logs[LOGNAME_STOP],
+		LastLog:                 logs[LOGNAME_ALIVE],
+		LatestKnowTimeElsewhere: latestKnowTimeElsewhere, //If knows from latest stored timestamp on timeseries database
+		UptimeCheck:             &uptimeCheck,
+		HwClock:                 &hwRtc, //Falls back to time.Now() if there is no RTC chip
+	}
+	result, newErr := conf.Init()
+	if newErr != nil {
+		return result, fmt.Errorf("NewTimeGopher error %v", newErr)
 	}
+	return result, nil
+}
 
-	stoStart, errStartLast := confStart.InitFileStorage()
-	if errStartLast != nil {
-		return TimeGopher{}, fmt.Errorf("startlog init err %v", errStartLast)
-	}
-	startLog, errDisk = CreateTimeFileDb(&stoStart, false)
-	if errDisk != nil {
-		return TimeGopher{}, fmt.Errorf("startlog create err %v", errDisk)
-	}
+/*
+defaultLogStorageConf is file storage of log on directory (see CreateDefaultTimeGopher)
+Uncertain RTC: when user syncs or some unreliable source "better than nothing"
+RTC: good sync from good clock source (NTP etc...)
+Start and stop: updated when program starts (copies previous alive)
+Alive: only few entries needed. At least one file, so no "no points" situation can happen when work flushes
+*/
+func defaultLogStorageConf(name string, dir string) fixregsto.FileStorageConf {
+	switch name {
+	case LOGNAME_RTC:
+		return fixregsto.FileStorageConf{Name: DEFAULTDBFILE_RTC, RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxFileCount: 256, FileMaxSize: 512 * 4, Path: dir}
+	case LOGNAME_UNCERTAINRTC:
+		return fixregsto.FileStorageConf{Name: DEFAULTDBFILE_UNCERTAINRTC, RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxFileCount: 256, FileMaxSize: 512 * 4, Path: dir}
+	case LOGNAME_START:
+		return fixregsto.FileStorageConf{Name: DEFAULTDBFILE_STARTLOG, RecordSize: RECORDSIZE_TIMEVARIABLE_NORTC, MaxFileCount: 256, FileMaxSize: 512 * 4, Path: dir}
+	case LOGNAME_STOP:
+		return fixregsto.FileStorageConf{Name: DEFAULTDBFILE_STOPLOG, RecordSize: RECORDSIZE_TIMEVARIABLE_NORTC, MaxFileCount: 256, FileMaxSize: 512 * 4, Path: dir}
+	}
+	return fixregsto.FileStorageConf{Name: DEFAULTDBFILE_ALIVELOG, RecordSize: RECORDSIZE_TIMEVARIABLE_NORTC, MaxFileCount: 1, FileMaxSize: 512, Path: dir}
+}
 
-	/*
-		STOP
-	*/
-	confStop := fixregsto.FileStorageConf{
-		Name:         DEFAULTDBFILE_STOPLOG,
-		RecordSize:   RECORDSIZE_TIMEVARIABLE_NORTC,
-		MaxFileCount: 256,
-		FileMaxSize:  512 * 4,
-		Path:         rtcLogDir,
+//openLogDir opens logs of CreateDefaultTimeGopher by name (LOGNAME_...)
+func openLogDir(dir string) (map[string]*TimeFileDb, error) {
+	result := make(map[string]*TimeFileDb)
+	for _, name := range LOGNAMES {
+		conf := defaultLogStorageConf(name, dir)
+		sto, errSto := conf.InitFileStorage()
+		if errSto != nil {
+			return result, fmt.Errorf("%s log init error %v", name, errSto)
+		}
+		db, errDb := CreateTimeFileDb(&sto, conf.RecordSize == RECORDSIZE_TIMEVARIABLE_RTC)
+		if errDb != nil {
+			return result, fmt.Errorf("%s log create error %v", name, errDb)
+		}
+		result[name] = &db
 	}
+	return result, nil
+}
 
-	stoStop, errStopLast := confStop.InitFileStorage()
-	if errStopLast != nil {
-		return TimeGopher{}, errStartLast
-	}
-	stopLog, errDisk = CreateTimeFileDb(&stoStop, false)
-	if errDisk != nil {
-		return TimeGopher{}, errDisk
+/*
+Create default TimeGopher that stores all logs in one journal (see TimeJournal) instead of five FileStorages.
+Uses less files and one fsync per Refresh. Close journal when software stops
+*/
+func CreateJournalTimeGopher(rtcLogDir string, latestKnowTimeElsewhere TimeVariable) (TimeGopher, *TimeJournal, error) {
+	inSync, errInSync := RtcIsSynced_adjtimex()
+	if errInSync != nil {
+		return TimeGopher{}, nil, fmt.Errorf("checking rtc sync error= %v", errInSync)
 	}
 
-	//****** Alive log. Only few entries needed
-	confAlive := fixregsto.FileStorageConf{
-		Name:         DEFAULTDBFILE_ALIVELOG,
-		RecordSize:   RECORDSIZE_TIMEVARIABLE_NORTC,
-		MaxFileCount: 1,   //At least one, so no "no points" situation can happen when work flushes
-		FileMaxSize:  512, //Todo prefered min size somewhere?
-		Path:         rtcLogDir,
+	firstRunAfterBoot, errFirstRunAfterBoot := FirstCallAfterBoot(WARMSTARTFILE)
+	if errFirstRunAfterBoot != nil {
+		return TimeGopher{}, nil, fmt.Errorf("FirstCallAfterBoot:%v", errFirstRunAfterBoot)
 	}
 
-	stoLast, errLast := confAlive.InitFileStorage()
-	if errLast != nil {
-		return TimeGopher{}, errLast
+	conf := TimeJournalConf{
+		Name:            DEFAULTJOURNALNAME,
+		Path:            rtcLogDir,
+		SegmentMaxSize:  512 * 128,
+		MaxSegmentCount: 16,
+		MaxRecords: map[JournalTag]int{ //Same amount of entries as CreateDefaultTimeGopher keeps
+			JOURNALTAG_UNCERTAINRTC: 256 * 512 * 4 / RECORDSIZE_TIMEVARIABLE_RTC,
+			JOURNALTAG_RTC:          256 * 512 * 4 / RECORDSIZE_TIMEVARIABLE_RTC,
+			JOURNALTAG_START:        256 * 512 * 4 / RECORDSIZE_TIMEVARIABLE_NORTC,
+			JOURNALTAG_STOP:         256 * 512 * 4 / RECORDSIZE_TIMEVARIABLE_NORTC,
+			JOURNALTAG_ALIVE:        512 / RECORDSIZE_TIMEVARIABLE_NORTC,
+		},
 	}
-	lastLog, errDisk = CreateTimeFileDb(&stoLast, false)
-	if errDisk != nil {
-		return TimeGopher{}, errDisk
+	journal, errJournal := conf.InitTimeJournal()
+	if errJournal != nil {
+		return TimeGopher{}, nil, fmt.Errorf("journal init error %v", errJournal)
 	}
 
 	uptimeCheck, errCreateUptimeChecker := CreateUptimeChecker()
 	if errCreateUptimeChecker != nil {
-		return TimeGopher{}, errCreateUptimeChecker
-	}
-
-	result, newErr := NewTimeGopher(
-		time.Now(), //timeNow time.Time,
-		inSync,
-		firstRunAfterBoot,
-		//These have RTC time
-		&rtcLog,
-		&uncertainRtcLog,
-		&startLog,
-		&stopLog,
-		&lastLog,
-		latestKnowTimeElsewhere, // TimeVariable, //If knows from latest stored timestamp on timeseries database
-		&uptimeCheck,
-	)
+		journal.Close()
+		return TimeGopher{}, nil, errCreateUptimeChecker
+	}
+
+	hwRtc := CreateHwRtc()
+	gopherConf := TimeGopherConf{
+		TimeNow:                 time.Now(),
+		InSync:                  inSync,
+		ColdStart:               firstRunAfterBoot,
+		RtcSyncLog:              journal.Log(JOURNALTAG_RTC),
+		UncertainRtcSyncLog:     journal.Log(JOURNALTAG_UNCERTAINRTC),
+		StartLog:                journal.Log(JOURNALTAG_START),
+		StopLog:                 journal.Log(JOURNALTAG_STOP),
+		LastLog:                 journal.Log(JOURNALTAG_ALIVE),
+		LatestKnowTimeElsewhere: latestKnowTimeElsewhere,
+		UptimeCheck:             &uptimeCheck,
+		HwClock:                 &hwRtc,
+	}
+	result, newErr := gopherConf.Init()
 	if newErr != nil {
-		return result, fmt.Errorf("NewTimeGopher error %v", newErr)
+		journal.Close()
+		return result, nil, fmt.Errorf("NewTimeGopher error %v", newErr)
 	}
-	return result, nil
+	return result, journal, nil
 }
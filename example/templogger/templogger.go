@@ -19,14 +19,17 @@ import (
 
 var rtcSystem timegopher.TimeGopher
 
-func dumbDbToFile(db *timegopher.TimeFileDb, filename string) error {
-	_, errCount := (*db).Len()
+func dumbDbToFile(db timegopher.TimeLog, filename string) error {
+	_, errCount := db.Len()
 	if errCount != nil {
 		return errCount
 	}
-	arr, arrErr := (*db).GetFirstN(int(999999999))
-	if arrErr != nil {
-		return arrErr
+	arr := []timegopher.TimeVariable{}
+	for tv, errIter := range db.Forward() {
+		if errIter != nil {
+			return fmt.Errorf("reading %v failed err=%v", filename, errIter)
+		}
+		arr = append(arr, tv)
 	}
 	return ioutil.WriteFile(filename, []byte(timegopher.TimeVariableList(arr).String()), 0666)
 }
@@ -0,0 +1,254 @@
+/*
+HTTP diagnostics handler
+
+Ready made http.Handler for field debugging. JSON endpoints
+
+	GET /status             sync state, boot number, uptime and deviation
+	GET /boots              software runs (see Sessions)
+	GET /logs/{name}        entries of log (rtc, uncertain, start, stop, alive). Optional parameter n for latest n entries
+	GET /convert?t=         converts RFC3339 time (default now) to TimeVariable
+	GET /unconvert?boot=&uptime=   converts TimeVariable to time
+
+GET / renders same data as html page
+*/
+
+package timegopher
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type DiagnosticsStatus struct {
+	Synced      bool
+	ColdStart   bool
+	BootNumber  int32
+	Uptime      NsUptime
+	Now         time.Time
+	Latest      TimeVariable
+	Deviation   *NsEpoch       `json:",omitempty"` //Only when synced and solvable
+	LastSyncAge *time.Duration `json:",omitempty"`
+	LogLengths  map[string]int
+}
+
+type UnconvertResult struct {
+	Time  time.Time
+	Epoch NsEpoch
+}
+
+//DiagnosticsHandler serves diagnostics. TimeGopher is not goroutine safe, set Lock if Refresh is called from other goroutine
+type DiagnosticsHandler struct {
+	Gopher *TimeGopher
+	Lock   sync.Locker //Optional
+	mux    *http.ServeMux
+}
+
+//NewDiagnosticsHandler creates handler, lock is optional
+func NewDiagnosticsHandler(g *TimeGopher, lock sync.Locker) *DiagnosticsHandler {
+	result := &DiagnosticsHandler{Gopher: g, Lock: lock, mux: http.NewServeMux()}
+	result.mux.HandleFunc("GET /status", result.serveStatus)
+	result.mux.HandleFunc("GET /boots", result.serveBoots)
+	result.mux.HandleFunc("GET /logs/{name}", result.serveLog)
+	result.mux.HandleFunc("GET /convert", result.serveConvert)
+	result.mux.HandleFunc("GET /unconvert", result.serveUnconvert)
+	result.mux.HandleFunc("GET /{$}", result.servePage)
+	return result
+}
+
+func (p *DiagnosticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.Lock != nil {
+		p.Lock.Lock()
+		defer p.Lock.Unlock()
+	}
+	p.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	byt, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(byt)
+}
+
+//Status collects current status
+func (p *DiagnosticsHandler) Status(t time.Time) (DiagnosticsStatus, error) {
+	g := p.Gopher
+	result := DiagnosticsStatus{Synced: g.synced, ColdStart: g.coldStart, BootNumber: g.bootNumber, Now: t, LogLengths: make(map[string]int)}
+	var err error
+	result.Uptime, err = g.UptimeCheck.UptimeNano(t)
+	if err != nil {
+		return result, err
+	}
+	result.Latest, err = g.GetLatestTime()
+	if err != nil {
+		return result, err
+	}
+	if g.synced {
+		deviation, errDeviation := g.RtcDeviation(t)
+		if errDeviation == nil {
+			result.Deviation = &deviation
+		}
+	}
+	age, errAge := g.LastSyncAge(t)
+	if errAge == nil {
+		result.LastSyncAge = &age
+	}
+	for name, db := range g.NamedLogs() {
+		result.LogLengths[name], err = db.Len()
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (p *DiagnosticsHandler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := p.Status(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (p *DiagnosticsHandler) serveBoots(w http.ResponseWriter, r *http.Request) {
+	sessions, err := p.Gopher.Sessions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, sessions)
+}
+
+//logEntries gets entries from named log. n<=0 gives all
+func (p *DiagnosticsHandler) logEntries(name string, n int) ([]TimeVariable, error) {
+	db, haz := p.Gopher.NamedLogs()[name]
+	if !haz {
+		return nil, fmt.Errorf("log %s not found", name)
+	}
+	if 0 < n {
+		return db.GetLatestN(n)
+	}
+	return db.All()
+}
+
+func (p *DiagnosticsHandler) serveLog(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	if r.URL.Query().Has("n") {
+		var errN error
+		n, errN = strconv.Atoi(r.URL.Query().Get("n"))
+		if errN != nil {
+			http.Error(w, fmt.Sprintf("invalid n %v", errN), http.StatusBadRequest)
+			return
+		}
+	}
+	arr, err := p.logEntries(r.PathValue("name"), n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, arr)
+}
+
+func (p *DiagnosticsHandler) serveConvert(w http.ResponseWriter, r *http.Request) {
+	t := time.Now()
+	if r.URL.Query().Has("t") {
+		var errParse error
+		t, errParse = time.Parse(time.RFC3339Nano, r.URL.Query().Get("t"))
+		if errParse != nil {
+			http.Error(w, fmt.Sprintf("invalid t %v", errParse), http.StatusBadRequest)
+			return
+		}
+	}
+	tv, err := p.Gopher.Convert(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, tv)
+}
+
+func (p *DiagnosticsHandler) serveUnconvert(w http.ResponseWriter, r *http.Request) {
+	boot, errBoot := strconv.ParseInt(r.URL.Query().Get("boot"), 10, 32)
+	uptime, errUptime := strconv.ParseInt(r.URL.Query().Get("uptime"), 10, 64)
+	if errBoot != nil || errUptime != nil {
+		http.Error(w, "parameters boot and uptime (ns) are required", http.StatusBadRequest)
+		return
+	}
+	t, err := p.Gopher.SolveTime(int32(boot), NsUptime(uptime))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, UnconvertResult{Time: t, Epoch: NsEpoch(t.UnixNano())})
+}
+
+var diagnosticsPage = template.Must(template.New("diag").Parse(`<!DOCTYPE html>
+<html><head><title>TimeGopher</title>
+<style>body{font-family:monospace} table{border-collapse:collapse} td,th{border:1px solid #888;padding:2px 6px}</style>
+</head><body>
+<h1>TimeGopher</h1>
+{{with .Status}}
+<table>
+<tr><th>Synced</th><td>{{.Synced}}</td></tr>
+<tr><th>Cold start</th><td>{{.ColdStart}}</td></tr>
+<tr><th>Boot number</th><td>{{.BootNumber}}</td></tr>
+<tr><th>Uptime</th><td>{{.Uptime}}</td></tr>
+<tr><th>Now</th><td>{{.Now}}</td></tr>
+<tr><th>Deviation</th><td>{{if .Deviation}}{{.Deviation}}{{else}}-{{end}}</td></tr>
+<tr><th>Last sync age</th><td>{{if .LastSyncAge}}{{.LastSyncAge}}{{else}}-{{end}}</td></tr>
+</table>
+{{end}}
+{{if .Error}}<p>Error: {{.Error}}</p>{{end}}
+<h2>Boots</h2>
+<table><tr><th>Boot</th><th>Start uptime</th><th>Stop uptime</th><th>Cold start</th><th>Running</th><th>Clean stop</th></tr>
+{{range .Sessions}}<tr><td>{{.Start.BootNumber}}</td><td>{{.Start.Uptime}}</td><td>{{.Stop.Uptime}}</td><td>{{.ColdStart}}</td><td>{{.Running}}</td><td>{{.Clean}}</td></tr>
+{{end}}</table>
+{{range $name, $entries := .Logs}}
+<h2>Log {{$name}} (latest)</h2>
+<table><tr><th>Boot</th><th>Uptime</th><th>Epoch</th></tr>
+{{range $entries}}<tr><td>{{.BootNumber}}</td><td>{{.Uptime}}</td><td>{{.Epoch}}</td></tr>
+{{end}}</table>
+{{end}}
+</body></html>
+`))
+
+//How many latest entries per log are shown on html page
+const DIAGNOSTICSPAGE_LOGENTRIES = 20
+
+func (p *DiagnosticsHandler) servePage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Status   DiagnosticsStatus
+		Sessions []Session
+		Logs     map[string][]TimeVariable
+		Error    string
+	}{Logs: make(map[string][]TimeVariable)}
+
+	var err error
+	data.Status, err = p.Status(time.Now())
+	if err == nil {
+		data.Sessions, err = p.Gopher.Sessions()
+	}
+	for name := range p.Gopher.NamedLogs() {
+		if err != nil {
+			break
+		}
+		data.Logs[name], err = p.logEntries(name, DIAGNOSTICSPAGE_LOGENTRIES)
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	errTemplate := diagnosticsPage.Execute(w, data)
+	if errTemplate != nil {
+		fmt.Fprintf(w, "template error %v", errTemplate)
+	}
+}
@@ -0,0 +1,69 @@
+package timegopher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticsHandler(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Now()
+	g, errCreate := NewTimeGopher(tNow, true, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+	dut := NewDiagnosticsHandler(&g, nil)
+
+	get := func(url string) (int, string) {
+		rec := httptest.NewRecorder()
+		dut.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := get("/status")
+	assert.Equal(t, 200, code)
+	status := DiagnosticsStatus{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &status))
+	assert.Equal(t, true, status.Synced)
+	assert.Equal(t, int32(1), status.BootNumber)
+	assert.Equal(t, 1, status.LogLengths[LOGNAME_RTC])
+
+	code, body = get("/boots")
+	assert.Equal(t, 200, code)
+	sessions := []Session{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &sessions))
+	assert.Equal(t, 1, len(sessions))
+
+	code, body = get("/logs/rtc?n=1")
+	assert.Equal(t, 200, code)
+	entries := []TimeVariable{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &entries))
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000, Epoch: NsEpoch(tNow.UnixNano())}, entries[0])
+
+	code, _ = get("/logs/nosuch")
+	assert.Equal(t, 404, code)
+
+	tConvert := time.Unix(0, tNow.UnixNano()).Add(time.Second)
+	code, body = get("/convert?t=" + tConvert.Format(time.RFC3339Nano))
+	assert.Equal(t, 200, code)
+	tv := TimeVariable{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &tv))
+	assert.Equal(t, int32(1), tv.BootNumber)
+
+	code, body = get(fmt.Sprintf("/unconvert?boot=1&uptime=%v", 1000+NsUptime(time.Second)))
+	assert.Equal(t, 200, code)
+	unconverted := UnconvertResult{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(body), &unconverted))
+	assert.Equal(t, NsEpoch(tNow.Add(time.Second).UnixNano()), unconverted.Epoch)
+
+	code, _ = get("/unconvert?boot=x")
+	assert.Equal(t, 400, code)
+
+	code, body = get("/")
+	assert.Equal(t, 200, code)
+	assert.True(t, strings.Contains(body, "<h2>Log rtc (latest)</h2>"))
+}
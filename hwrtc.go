@@ -0,0 +1,147 @@
+/*
+Battery backed hardware RTC
+
+Boards without network at boot can get better initial guess from RTC chip than from system clock.
+HwRtc reads /sys/class/rtc/rtc0/since_epoch and if that is not available, /dev/rtc with RTC_RD_TIME ioctl.
+RTC is assumed to be in UTC (like hwclock --utc)
+
+Reading is checked against latest known epoch on logs. RTC with dead battery usually restarts from year 1970 or 2000
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	HWRTC_SYSFSDIR = "/sys/class/rtc"
+	HWRTC_NAME     = "rtc0"
+	HWRTC_DEVICE   = "/dev/rtc"
+)
+
+//RTC chips have one second resolution
+const HWRTC_ERRORESTIMATE = NsEpoch(time.Second)
+
+//_IOR('p', 0x09, struct rtc_time)
+const RTC_RD_TIME = 0x80247009
+
+//HwClock is source of initial uncertain sync
+type HwClock interface {
+	ReadHwClock() (time.Time, error)
+}
+
+//HwRtc reads linux RTC device
+type HwRtc struct {
+	Fsys   fs.FS  //Root of rtc class, like os.DirFS(HWRTC_SYSFSDIR). Nil skips sysfs
+	Name   string //Like rtc0
+	Device string //Device for ioctl, like /dev/rtc. Empty skips ioctl
+}
+
+//CreateHwRtc creates HwRtc with default linux paths
+func CreateHwRtc() HwRtc {
+	return HwRtc{Fsys: os.DirFS(HWRTC_SYSFSDIR), Name: HWRTC_NAME, Device: HWRTC_DEVICE}
+}
+
+//rtc_time from linux/rtc.h, same as struct tm
+type rtcTime struct {
+	Sec   int32
+	Min   int32
+	Hour  int32
+	Mday  int32
+	Mon   int32
+	Year  int32
+	Wday  int32
+	Yday  int32
+	Isdst int32
+}
+
+func (p *HwRtc) ReadHwClock() (time.Time, error) {
+	errSysfs := fmt.Errorf("sysfs not set")
+	if p.Fsys != nil {
+		var t time.Time
+		t, errSysfs = p.readSysfs()
+		if errSysfs == nil {
+			return t, nil
+		}
+	}
+	if len(p.Device) == 0 {
+		return time.Time{}, errSysfs
+	}
+	t, errIoctl := p.readIoctl()
+	if errIoctl != nil {
+		return time.Time{}, fmt.Errorf("reading hw rtc failed sysfs err=%v, ioctl err=%v", errSysfs, errIoctl)
+	}
+	return t, nil
+}
+
+func (p *HwRtc) readSysfs() (time.Time, error) {
+	raw, errRead := fs.ReadFile(p.Fsys, p.Name+"/since_epoch")
+	if errRead != nil {
+		return time.Time{}, errRead
+	}
+	sec, errParse := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if errParse != nil {
+		return time.Time{}, fmt.Errorf("invalid since_epoch %v", errParse)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+func (p *HwRtc) readIoctl() (time.Time, error) {
+	fd, errOpen := syscall.Open(p.Device, syscall.O_RDONLY, 0)
+	if errOpen != nil {
+		return time.Time{}, errOpen
+	}
+	defer syscall.Close(fd)
+	tm := rtcTime{}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), RTC_RD_TIME, uintptr(unsafe.Pointer(&tm)))
+	if errno != 0 {
+		return time.Time{}, errno
+	}
+	return time.Date(int(tm.Year)+1900, time.Month(tm.Mon+1), int(tm.Mday), int(tm.Hour), int(tm.Min), int(tm.Sec), 0, time.UTC), nil
+}
+
+//latestKnownEpoch is latest epoch on sync logs
+func (p *TimeGopher) latestKnownEpoch(latestKnowTimeElsewhere TimeVariable) (NsEpoch, error) {
+	result := latestKnowTimeElsewhere.Epoch
+	for _, db := range []TimeLog{p.RtcSyncLog, p.UncertainRtcSyncLog} {
+		if db == nil {
+			continue
+		}
+		arr, errArr := db.GetLatestN(1)
+		if errArr != nil {
+			return result, errArr
+		}
+		if 0 < len(arr) && result < arr[0].Epoch {
+			result = arr[0].Epoch
+		}
+	}
+	return result, nil
+}
+
+//readHwClock reads hardware clock and checks that it is not before latest known epoch
+func (p *TimeGopher) readHwClock(clock HwClock, latestKnowTimeElsewhere TimeVariable) (NsEpoch, error) {
+	t, errRead := clock.ReadHwClock()
+	if errRead != nil {
+		return 0, errRead
+	}
+	result := NsEpoch(t.UnixNano())
+	if result < EPOCH70S {
+		return result, fmt.Errorf("hw clock %v is not set", t)
+	}
+	latest, errLatest := p.latestKnownEpoch(latestKnowTimeElsewhere)
+	if errLatest != nil {
+		return result, errLatest
+	}
+	if result < latest {
+		return result, fmt.Errorf("hw clock %v is before latest known time %v", t, time.Unix(0, int64(latest)))
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package timegopher
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHwRtcSysfs(t *testing.T) {
+	dut := HwRtc{Fsys: fstest.MapFS{"rtc0/since_epoch": &fstest.MapFile{Data: []byte("1658334427\n")}}, Name: "rtc0"}
+	tRtc, errRead := dut.ReadHwClock()
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, int64(1658334427), tRtc.Unix())
+
+	dut.Name = "rtc1"
+	_, errRead = dut.ReadHwClock()
+	assert.NotEqual(t, nil, errRead)
+}
+
+func TestHwRtcInitialSync(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_SYNCRECORD, MaxRecords: 16}
+	memsto, errMem := memconf.InitMemLoop()
+	assert.Equal(t, nil, errMem)
+	metaDb, errMeta := CreateSyncMetaDb(&memsto)
+	assert.Equal(t, nil, errMeta)
+
+	//System clock starts from 1970's+something, RTC chip knows time
+	tNow := time.Unix(1000, 0)
+	tRtc := time.Unix(1658334427, 0)
+	rtc, uncertain, start, stop, last := testMemLogs()
+	conf := TimeGopherConf{
+		TimeNow:             tNow,
+		ColdStart:           true,
+		RtcSyncLog:          rtc,
+		UncertainRtcSyncLog: uncertain,
+		StartLog:            start,
+		StopLog:             stop,
+		LastLog:             last,
+		UptimeCheck:         testUptimeChecker(tNow, 1000),
+		SyncMetaLog:         &metaDb,
+		HwClock:             &HwRtc{Fsys: fstest.MapFS{"rtc0/since_epoch": &fstest.MapFile{Data: []byte("1658334427\n")}}, Name: "rtc0"},
+	}
+	dut, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+	solved, errSolve := dut.SolveTime(1, 1000+NsUptime(time.Second))
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tRtc.Add(time.Second), solved)
+	all, _ := metaDb.All()
+	assert.Equal(t, 1, len(all))
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_RTC, ErrorEstimate: HWRTC_ERRORESTIMATE}, all[0].SyncMeta)
+
+	//RTC is behind of latest known time (battery dead). Falls back to system clock
+	rtc, uncertain, start, stop, last = testMemLogs()
+	conf.RtcSyncLog, conf.UncertainRtcSyncLog, conf.StartLog, conf.StopLog, conf.LastLog = rtc, uncertain, start, stop, last
+	conf.TimeNow = tRtc.Add(time.Hour)
+	conf.UptimeCheck = testUptimeChecker(conf.TimeNow, 1000)
+	conf.LatestKnowTimeElsewhere = TimeVariable{BootNumber: 1, Uptime: 5000, Epoch: NsEpoch(tRtc.Add(time.Minute).UnixNano())}
+	dut, errInit = conf.Init()
+	assert.Equal(t, nil, errInit)
+	entries, _ := uncertain.All()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, NsEpoch(conf.TimeNow.UnixNano()), entries[0].Epoch)
+}
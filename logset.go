@@ -0,0 +1,289 @@
+/*
+Merging logs
+
+When failed SD card is replaced, logs are restored from backup that misses latest boots. Software then
+continues with boot numbers that were already used. MergeLogSets combines logs from several sources.
+Same boot on different sources is detected by start log entry and epoch of boot. Conflicting boots are
+ordered by time and renumbered. BootMapping tells new numbers so application data can be renumbered too.
+Only TimeLogs are merged. SyncMetaLog, ClockEventLog and JumpLog are also keyed by boot number, they are not
+renumbered and application have to apply BootMapping to them if those are kept
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+//LogSet is content of logs by name (LOGNAME_...)
+type LogSet map[string]TimeVariableList
+
+//Epoch at uptime 0 can differ this much and still be same boot
+const LOGMERGE_BOOTEPOCHTOLERANCE NsEpoch = 5 * 1000 * 1000 * 1000
+
+//BootMapping have renumbered boots of each merged log set, index is same as in MergeLogSets (0 is current)
+type BootMapping []map[int32]int32
+
+//Boot gives new boot number of boot on log set
+func (p BootMapping) Boot(set int, boot int32) int32 {
+	if set < 0 || len(p) <= set {
+		return boot
+	}
+	renumbered, found := p[set][boot]
+	if found {
+		return renumbered
+	}
+	return boot
+}
+
+//bootFingerprint identifies boot on log set
+type bootFingerprint struct {
+	startUptime NsUptime
+	hasStart    bool
+	bootEpoch   NsEpoch //Epoch at uptime 0
+	hasEpoch    bool
+}
+
+//same tells is boot same as ref. If there is nothing to compare boots are not same and are renumbered
+func (p *bootFingerprint) same(ref bootFingerprint) bool {
+	if p.hasStart && ref.hasStart {
+		return p.startUptime == ref.startUptime
+	}
+	if p.hasEpoch && ref.hasEpoch {
+		return p.bootEpoch.Diff(ref.bootEpoch) < LOGMERGE_BOOTEPOCHTOLERANCE
+	}
+	return false
+}
+
+func (p LogSet) fingerprints() map[int32]bootFingerprint {
+	result := make(map[int32]bootFingerprint)
+	for _, name := range LOGNAMES {
+		for _, tv := range p[name] {
+			fp := result[tv.BootNumber]
+			if name == LOGNAME_START && !fp.hasStart {
+				fp.startUptime = tv.Uptime
+				fp.hasStart = true
+			}
+			//Certain sync is listed first on LOGNAMES
+			if (name == LOGNAME_RTC || name == LOGNAME_UNCERTAINRTC) && !fp.hasEpoch {
+				fp.bootEpoch = tv.Epoch - NsEpoch(tv.Uptime)
+				fp.hasEpoch = true
+			}
+			result[tv.BootNumber] = fp
+		}
+	}
+	return result
+}
+
+type mergedBoot struct {
+	members map[int]int32 //log set index -> boot number on set
+	set     int           //First log set having this boot
+	boot    int32         //Boot number on first log set
+	index   int           //Position on sorted boot numbers of first log set
+	next    []*mergedBoot //New boots that follow this boot on some log set
+}
+
+/*
+MergeLogSets merges log sets. Set 0 is current, others are like backups. Returns merged logs and renumbered boots.
+Boots that are not on previous sets are kept together after last shared boot. Those groups from different sets are
+ordered by epoch of first boot having sync entry. Without epoch backups are ordered before current
+*/
+func MergeLogSets(sets ...LogSet) (LogSet, BootMapping, error) {
+	if len(sets) == 0 {
+		return LogSet{}, BootMapping{}, fmt.Errorf("no log sets to merge")
+	}
+	allFps := make([]map[int32]bootFingerprint, len(sets))
+	allNumbers := make([][]int32, len(sets))
+	for i, set := range sets {
+		allFps[i] = set.fingerprints()
+		numbers := make([]int32, 0, len(allFps[i]))
+		for boot := range allFps[i] {
+			numbers = append(numbers, boot)
+		}
+		sort.Slice(numbers, func(a, b int) bool { return numbers[a] < numbers[b] })
+		allNumbers[i] = numbers
+	}
+
+	root := &mergedBoot{}
+	boots := []*mergedBoot{}
+	for i, numbers := range allNumbers {
+		prev := root
+		for index, boot := range numbers {
+			fp := allFps[i][boot]
+			var match *mergedBoot
+			for _, m := range boots {
+				if m.set < i && m.boot == boot && fp.same(allFps[m.set][boot]) {
+					match = m
+					break
+				}
+			}
+			if match == nil {
+				match = &mergedBoot{members: map[int]int32{}, set: i, boot: boot, index: index}
+				boots = append(boots, match)
+				prev.next = append(prev.next, match)
+			}
+			match.members[i] = boot
+			prev = match
+		}
+	}
+
+	//segmentEpoch is epoch of first boot with sync entry starting from boot on its set
+	segmentEpoch := func(m *mergedBoot) (NsEpoch, bool) {
+		for _, boot := range allNumbers[m.set][m.index:] {
+			fp := allFps[m.set][boot]
+			if fp.hasEpoch {
+				return fp.bootEpoch, true
+			}
+		}
+		return 0, false
+	}
+	//Current set is newest if epochs are not known
+	priority := func(set int) int {
+		if set == 0 {
+			return len(sets)
+		}
+		return set
+	}
+	ordered := []*mergedBoot{}
+	var walk func(m *mergedBoot)
+	walk = func(m *mergedBoot) {
+		sort.SliceStable(m.next, func(a, b int) bool {
+			epochA, knownA := segmentEpoch(m.next[a])
+			epochB, knownB := segmentEpoch(m.next[b])
+			if knownA && knownB && epochA != epochB {
+				return epochA < epochB
+			}
+			return priority(m.next[a].set) < priority(m.next[b].set)
+		})
+		for _, next := range m.next {
+			ordered = append(ordered, next)
+			walk(next)
+		}
+	}
+	walk(root)
+
+	mapping := make(BootMapping, len(sets))
+	for i := range mapping {
+		mapping[i] = make(map[int32]int32)
+	}
+	latest := int32(-1)
+	for _, m := range ordered {
+		number := m.boot
+		if number <= latest {
+			number = latest + 1
+		}
+		latest = number
+		for set, boot := range m.members {
+			if boot != number {
+				mapping[set][boot] = number
+			}
+		}
+	}
+
+	result := LogSet{}
+	for _, name := range LOGNAMES {
+		merged := TimeVariableList{}
+		for i, set := range sets {
+			for _, tv := range set[name] {
+				tv.BootNumber = mapping.Boot(i, tv.BootNumber)
+				merged = append(merged, tv)
+			}
+		}
+		sort.Stable(merged)
+		unique := TimeVariableList{}
+		for _, tv := range merged {
+			if unique.checkAppend(tv) == nil { //Same boot and uptime from several sets, first is kept
+				unique = append(unique, tv)
+			}
+		}
+		if 0 < len(unique) {
+			result[name] = unique
+		}
+	}
+	return result, mapping, nil
+}
+
+//ReadLogDir reads logs from directory created by CreateDefaultTimeGopher
+func ReadLogDir(dir string) (LogSet, error) {
+	_, errStat := os.Stat(dir)
+	if errStat != nil {
+		return LogSet{}, errStat
+	}
+	dbs, errOpen := openLogDir(dir)
+	if errOpen != nil {
+		return LogSet{}, errOpen
+	}
+	result := LogSet{}
+	for name, db := range dbs {
+		arr, errAll := db.All()
+		if errAll != nil {
+			return result, errAll
+		}
+		if 0 < len(arr) {
+			result[name] = arr
+		}
+	}
+	return result, nil
+}
+
+//WriteLogDir writes logs to directory in CreateDefaultTimeGopher format. Logs on directory must be empty
+func WriteLogDir(dir string, logs LogSet) error {
+	dbs, errOpen := openLogDir(dir)
+	if errOpen != nil {
+		return errOpen
+	}
+	for _, name := range LOGNAMES {
+		n, _ := dbs[name].Len()
+		if n != 0 {
+			return fmt.Errorf("%s log on %s is not empty, have %v records", name, dir, n)
+		}
+		for _, tv := range logs[name] {
+			errInsert := dbs[name].Insert(tv)
+			if errInsert != nil {
+				return fmt.Errorf("error inserting %#v to %s log err=%v", tv, name, errInsert)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+MergeLogDirs merges log directories (CreateDefaultTimeGopher format) to current directory. Call before creating TimeGopher.
+Original current directory is kept as current+".premerge". Mapping index 0 is current, 1... are dirs
+*/
+func MergeLogDirs(current string, dirs ...string) (BootMapping, error) {
+	sets := []LogSet{}
+	for _, dir := range append([]string{current}, dirs...) {
+		set, errRead := ReadLogDir(dir)
+		if errRead != nil {
+			return nil, fmt.Errorf("reading logs from %s failed err=%v", dir, errRead)
+		}
+		sets = append(sets, set)
+	}
+	merged, mapping, errMerge := MergeLogSets(sets...)
+	if errMerge != nil {
+		return mapping, errMerge
+	}
+
+	tmpDir := current + ".merge"
+	backupDir := current + ".premerge"
+	for _, dir := range []string{tmpDir, backupDir} {
+		_, errStat := os.Stat(dir)
+		if errStat == nil {
+			return mapping, fmt.Errorf("%s already exists", dir)
+		}
+	}
+	errWrite := WriteLogDir(tmpDir, merged)
+	if errWrite != nil {
+		os.RemoveAll(tmpDir)
+		return mapping, errWrite
+	}
+	errBackup := os.Rename(current, backupDir)
+	if errBackup != nil {
+		os.RemoveAll(tmpDir)
+		return mapping, errBackup
+	}
+	return mapping, os.Rename(tmpDir, current)
+}
@@ -0,0 +1,113 @@
+package timegopher
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//testBootLogs creates log entries of one boot, started at epoch
+func testBootLogs(logs LogSet, boot int32, startUptime NsUptime, epoch NsEpoch) {
+	logs[LOGNAME_START] = append(logs[LOGNAME_START], TimeVariable{BootNumber: boot, Uptime: startUptime})
+	logs[LOGNAME_RTC] = append(logs[LOGNAME_RTC], TimeVariable{BootNumber: boot, Uptime: startUptime + 1000, Epoch: epoch + NsEpoch(startUptime) + 1000})
+	logs[LOGNAME_STOP] = append(logs[LOGNAME_STOP], TimeVariable{BootNumber: boot, Uptime: startUptime + NsUptime(time.Hour)})
+}
+
+func TestMergeLogSets(t *testing.T) {
+	day := NsEpoch(24 * time.Hour)
+	//Old card had boots 1-4, backup has boots 1-2. New card continues after backup with boots 3-4
+	old := LogSet{}
+	for boot := int32(1); boot <= 4; boot++ {
+		testBootLogs(old, boot, NsUptime(boot)*1000000, TESTEPOCH0+day*NsEpoch(boot))
+	}
+	current := LogSet{}
+	for boot := int32(1); boot <= 2; boot++ {
+		testBootLogs(current, boot, NsUptime(boot)*1000000, TESTEPOCH0+day*NsEpoch(boot))
+	}
+	testBootLogs(current, 3, 7777777, TESTEPOCH0+day*10)
+	testBootLogs(current, 4, 8888888, TESTEPOCH0+day*11)
+
+	merged, mapping, errMerge := MergeLogSets(current, old)
+	assert.Equal(t, nil, errMerge)
+	assert.Equal(t, BootMapping{{3: 5, 4: 6}, {}}, mapping)
+	assert.Equal(t, int32(5), mapping.Boot(0, 3))
+	assert.Equal(t, int32(3), mapping.Boot(1, 3))
+	assert.Equal(t, int32(2), mapping.Boot(0, 2))
+
+	starts := merged[LOGNAME_START]
+	assert.Equal(t, 6, len(starts))
+	for i, tv := range starts {
+		assert.Equal(t, int32(i+1), tv.BootNumber)
+	}
+	assert.Equal(t, TimeVariable{BootNumber: 5, Uptime: 7777777}, starts[4])
+	assert.Equal(t, 6, len(merged[LOGNAME_RTC]))
+	assert.Equal(t, 6, len(merged[LOGNAME_STOP]))
+
+	//Boot order by epoch, backup boots are after current
+	merged, mapping, errMerge = MergeLogSets(old, current)
+	assert.Equal(t, nil, errMerge)
+	assert.Equal(t, BootMapping{{}, {3: 5, 4: 6}}, mapping)
+	assert.Equal(t, 6, len(merged[LOGNAME_START]))
+
+	//Without sync entries boots of each set are kept together, backup first
+	current = LogSet{}
+	old = LogSet{}
+	for boot := int32(1); boot <= 4; boot++ {
+		old[LOGNAME_START] = append(old[LOGNAME_START], TimeVariable{BootNumber: boot, Uptime: NsUptime(boot) * 1000})
+		if boot <= 2 {
+			current[LOGNAME_START] = append(current[LOGNAME_START], TimeVariable{BootNumber: boot, Uptime: NsUptime(boot) * 1000})
+		} else {
+			current[LOGNAME_START] = append(current[LOGNAME_START], TimeVariable{BootNumber: boot, Uptime: NsUptime(boot) * 2000})
+		}
+	}
+	merged, mapping, errMerge = MergeLogSets(current, old)
+	assert.Equal(t, nil, errMerge)
+	assert.Equal(t, BootMapping{{3: 5, 4: 6}, {}}, mapping)
+	assert.Equal(t, TimeVariable{BootNumber: 6, Uptime: 8000}, merged[LOGNAME_START][5])
+
+	//Boot 2 have only stop entries, can not compare
+	current = LogSet{LOGNAME_START: {{BootNumber: 1, Uptime: 1000}}, LOGNAME_STOP: {{BootNumber: 2, Uptime: 5000}}}
+	old = LogSet{LOGNAME_START: {{BootNumber: 1, Uptime: 1000}}, LOGNAME_STOP: {{BootNumber: 2, Uptime: 6000}}}
+	merged, mapping, errMerge = MergeLogSets(current, old)
+	assert.Equal(t, nil, errMerge)
+	assert.Equal(t, BootMapping{{2: 3}, {}}, mapping)
+	assert.Equal(t, TimeVariableList{{BootNumber: 2, Uptime: 6000}, {BootNumber: 3, Uptime: 5000}}, merged[LOGNAME_STOP])
+
+	_, _, errMerge = MergeLogSets()
+	assert.NotEqual(t, nil, errMerge)
+}
+
+func TestMergeLogDirs(t *testing.T) {
+	day := NsEpoch(24 * time.Hour)
+	dir := t.TempDir()
+	currentDir := path.Join(dir, "current")
+	backupDir := path.Join(dir, "old")
+
+	old := LogSet{}
+	testBootLogs(old, 1, 1000000, TESTEPOCH0)
+	testBootLogs(old, 2, 2000000, TESTEPOCH0+day)
+	assert.Equal(t, nil, WriteLogDir(backupDir, old))
+	current := LogSet{}
+	testBootLogs(current, 1, 1000000, TESTEPOCH0)
+	testBootLogs(current, 2, 3000000, TESTEPOCH0+2*day)
+	assert.Equal(t, nil, WriteLogDir(currentDir, current))
+	assert.NotEqual(t, nil, WriteLogDir(currentDir, current)) //Not empty
+
+	mapping, errMerge := MergeLogDirs(currentDir, backupDir)
+	assert.Equal(t, nil, errMerge)
+	assert.Equal(t, BootMapping{{2: 3}, {}}, mapping)
+
+	merged, errRead := ReadLogDir(currentDir)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, 3, len(merged[LOGNAME_START]))
+	assert.Equal(t, TimeVariable{BootNumber: 3, Uptime: 3000000}, merged[LOGNAME_START][2])
+
+	premerge, errPremerge := ReadLogDir(currentDir + ".premerge")
+	assert.Equal(t, nil, errPremerge)
+	assert.Equal(t, current, premerge)
+
+	_, errMerge = MergeLogDirs(currentDir, backupDir) //Previous premerge must be handled first
+	assert.NotEqual(t, nil, errMerge)
+}
@@ -0,0 +1,190 @@
+/*
+Sync from measured offset without setting system clock
+
+On locked-down devices system clock can not be set (no ntpd, no SetSysClock). OffsetRefresher measures offset
+from any source that have GetOffset (like timesync.TimeSync implementations) and refreshes TimeGopher with
+RefreshWithOffset. Certain sync entries get epoch = system clock + offset
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"time"
+)
+
+//OffsetSource is same as timesync.TimeSync. Returns difference from system clock to correct time
+type OffsetSource interface {
+	GetOffset() (time.Duration, error)
+}
+
+//Leap indicator of unsynchronized clock (NTP alarm condition)
+const LEAP_ALARM = 3
+
+//SyncMeasurement is offset measurement with metadata. Create from timesync.SyncSample with MeasurementFromSample
+type SyncMeasurement struct {
+	Offset        time.Duration //Correct time - local clock
+	ErrorEstimate time.Duration //0 if not known
+	Source        string        //Like "ntp", "gps" or "http"
+	Server        string        //Server or device that answered
+	RTT           time.Duration
+	Stratum       uint8
+	Leap          uint8 //Leap indicator, LEAP_ALARM is not synchronized
+	Precision     time.Duration
+	Time          time.Time //Local clock when measured
+}
+
+//MeasurementSample gives measurement by methods, so timesync.SyncSample can be used without modules depending on each other
+type MeasurementSample interface {
+	SampleOffset() time.Duration
+	SampleErrorEstimate() time.Duration
+	SampleSource() string
+	SampleServer() string
+	SampleRTT() time.Duration
+	SampleStratum() uint8
+	SampleLeap() uint8
+	SamplePrecision() time.Duration
+	SampleTime() time.Time
+}
+
+//MeasurementFromSample creates SyncMeasurement from sample like timesync.SyncSample
+func MeasurementFromSample(sample MeasurementSample) SyncMeasurement {
+	return SyncMeasurement{
+		Offset:        sample.SampleOffset(),
+		ErrorEstimate: sample.SampleErrorEstimate(),
+		Source:        sample.SampleSource(),
+		Server:        sample.SampleServer(),
+		RTT:           sample.SampleRTT(),
+		Stratum:       sample.SampleStratum(),
+		Leap:          sample.SampleLeap(),
+		Precision:     sample.SamplePrecision(),
+		Time:          sample.SampleTime(),
+	}
+}
+
+//Meta converts measurement to SyncMeta. If error estimate is not known, half of round trip is used
+func (p SyncMeasurement) Meta() SyncMeta {
+	errorEstimate := p.ErrorEstimate
+	if errorEstimate == 0 {
+		errorEstimate = p.RTT / 2
+	}
+	return SyncMeta{Source: ParseSyncSource(p.Source), Stratum: p.Stratum, ErrorEstimate: NsEpoch(errorEstimate)}
+}
+
+/*
+RecordMeasurement records sync from measurement like RefreshWithOffset at measurement time. Measurement with unsynchronized
+leap indicator is not accepted. Measurement older than latest refresh can not be inserted to logs and is rejected, measure again
+*/
+func (p *TimeGopher) RecordMeasurement(m SyncMeasurement) error {
+	if m.Leap == LEAP_ALARM {
+		return fmt.Errorf("measurement from %s is not synchronized", m.Server)
+	}
+	tv, errConvert := p.Convert(m.Time)
+	if errConvert != nil {
+		return fmt.Errorf("converting measurement time %v failed err=%v", m.Time, errConvert)
+	}
+	for _, db := range []TimeLog{p.LastLog, p.RtcSyncLog} {
+		if db == nil {
+			continue
+		}
+		arr, errLatest := db.GetLatestN(1)
+		if errLatest != nil {
+			return errLatest
+		}
+		if 0 < len(arr) && !lessBootUptime(arr[0], tv) {
+			return fmt.Errorf("measurement from %s at %v is stale, not after latest refresh at boot %v uptime %v", m.Server, m.Time, arr[0].BootNumber, arr[0].Uptime)
+		}
+	}
+	return p.RefreshWithOffset(m.Time, m.Offset, m.Meta())
+}
+
+//OffsetSourceKind is optional interface, tells source name like "ntp" or "gps" (see ParseSyncSource)
+type OffsetSourceKind interface {
+	SourceKind() string
+}
+
+type OffsetRefresher struct {
+	Gopher          *TimeGopher
+	Source          OffsetSource
+	Measure         func() (SyncMeasurement, error) //Optional, used instead of Source. Gives metadata like timesync.SampleSync GetSample
+	Meta            SyncMeta                        //Stored with sync entries. If Source is unknown, it is taken from measurement, OffsetSourceKind or NTP is assumed
+	MeasureInterval time.Duration                   //Offset is measured again after this. Zero measures at every Refresh
+
+	offset       time.Duration
+	lastMeasured time.Time
+	measured     bool
+	measuredMeta SyncMeta
+}
+
+func (p *OffsetRefresher) meta() SyncMeta {
+	result := p.Meta
+	if result.Source != SYNCSOURCE_UNKNOWN {
+		return result
+	}
+	if p.Measure != nil {
+		result.Source = p.measuredMeta.Source
+		if result.Stratum == 0 {
+			result.Stratum = p.measuredMeta.Stratum
+		}
+		if result.ErrorEstimate == 0 {
+			result.ErrorEstimate = p.measuredMeta.ErrorEstimate
+		}
+		return result
+	}
+	result.Source = SYNCSOURCE_NTP
+	kind, hazKind := p.Source.(OffsetSourceKind)
+	if hazKind {
+		result.Source = ParseSyncSource(kind.SourceKind())
+	}
+	return result
+}
+
+func (p *OffsetRefresher) measure() (time.Duration, error) {
+	if p.Measure == nil {
+		return p.Source.GetOffset()
+	}
+	m, err := p.Measure()
+	if err != nil {
+		return 0, err
+	}
+	if m.Leap == LEAP_ALARM {
+		return 0, fmt.Errorf("measurement from %s is not synchronized", m.Server)
+	}
+	p.measuredMeta = m.Meta()
+	return m.Offset, nil
+}
+
+//Refresh measures offset if needed and refreshes TimeGopher. Call this instead of TimeGopher.Refresh.
+//If measurement fails, previous offset is used. TimeGopher is refreshed as not synced if offset is never measured.
+//Measurement error is returned after refresh
+func (p *OffsetRefresher) Refresh(t time.Time) error {
+	var errMeasure error
+	if !p.measured || p.MeasureInterval <= t.Sub(p.lastMeasured) {
+		offset, err := p.measure()
+		if err == nil {
+			p.offset = offset
+			p.lastMeasured = t
+			p.measured = true
+		} else {
+			errMeasure = fmt.Errorf("measuring offset failed err=%v", err)
+		}
+	}
+
+	if !p.measured {
+		errRefresh := p.Gopher.Refresh(t, false)
+		if errRefresh != nil {
+			return errRefresh
+		}
+		return errMeasure
+	}
+	errRefresh := p.Gopher.RefreshWithOffset(t, p.offset, p.meta())
+	if errRefresh != nil {
+		return errRefresh
+	}
+	return errMeasure
+}
+
+//RefreshNow is helper function for Refresh
+func (p *OffsetRefresher) RefreshNow() error {
+	return p.Refresh(time.Now())
+}
@@ -0,0 +1,116 @@
+package timegopher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testOffsetSource struct {
+	offset time.Duration
+	err    error
+}
+
+func (p *testOffsetSource) GetOffset() (time.Duration, error) {
+	return p.offset, p.err
+}
+
+func (p *testOffsetSource) SourceKind() string {
+	return "gps"
+}
+
+func TestOffsetRefresher(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+
+	//System clock is one hour behind
+	source := testOffsetSource{offset: time.Hour}
+	dut := OffsetRefresher{Gopher: &g, Source: &source, MeasureInterval: time.Minute}
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(10*time.Second)))
+	entries, _ := rtc.All()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, NsEpoch(tNow.Add(time.Hour+10*time.Second).UnixNano()), entries[0].Epoch)
+	assert.Equal(t, time.Hour, g.ClockOffset())
+
+	solved, errSolve := g.SolveTime(1, 1000+NsUptime(20*time.Second))
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tNow.Add(time.Hour+20*time.Second), solved)
+	tv, errConvert := g.Convert(tNow.Add(20 * time.Second))
+	assert.Equal(t, nil, errConvert)
+	assert.Equal(t, NsEpoch(tNow.Add(time.Hour+20*time.Second).UnixNano()), tv.Epoch)
+
+	//Offset changed but is not measured before interval
+	source.offset = time.Hour + 10*time.Second
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(30*time.Second)))
+	n, _ := rtc.Len()
+	assert.Equal(t, 1, n)
+
+	//Deviation is over RtcMaxDeviation, new entry
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(80*time.Second)))
+	entries, _ = rtc.All()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, NsEpoch(tNow.Add(time.Hour+90*time.Second).UnixNano()), entries[1].Epoch)
+
+	//Failing source keeps previous offset
+	source.err = fmt.Errorf("no fix")
+	assert.NotEqual(t, nil, dut.Refresh(tNow.Add(200*time.Second)))
+	assert.Equal(t, time.Hour+10*time.Second, g.ClockOffset())
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_GPS}, dut.meta())
+
+	//Refresh resets offset, system clock is the reference
+	assert.Equal(t, nil, g.Refresh(tNow.Add(300*time.Second), false))
+	assert.Equal(t, time.Duration(0), g.ClockOffset())
+}
+
+//testSample is like timesync.SyncSample
+type testSample struct {
+	m SyncMeasurement
+}
+
+func (p testSample) SampleOffset() time.Duration        { return p.m.Offset }
+func (p testSample) SampleErrorEstimate() time.Duration { return p.m.ErrorEstimate }
+func (p testSample) SampleSource() string               { return p.m.Source }
+func (p testSample) SampleServer() string               { return p.m.Server }
+func (p testSample) SampleRTT() time.Duration           { return p.m.RTT }
+func (p testSample) SampleStratum() uint8               { return p.m.Stratum }
+func (p testSample) SampleLeap() uint8                  { return p.m.Leap }
+func (p testSample) SamplePrecision() time.Duration     { return p.m.Precision }
+func (p testSample) SampleTime() time.Time              { return p.m.Time }
+
+func TestRecordMeasurement(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+
+	m := SyncMeasurement{Offset: time.Minute, Source: "ntp", Server: "10.0.0.1", RTT: 20 * time.Millisecond, Stratum: 2, Time: tNow.Add(time.Second), Precision: time.Microsecond}
+	assert.Equal(t, m, MeasurementFromSample(testSample{m: m}))
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_NTP, Stratum: 2, ErrorEstimate: NsEpoch(10 * time.Millisecond)}, m.Meta())
+	assert.Equal(t, nil, g.RecordMeasurement(m))
+	entries, _ := rtc.All()
+	assert.Equal(t, NsEpoch(tNow.Add(time.Minute+time.Second).UnixNano()), entries[0].Epoch)
+
+	//Older than latest refresh
+	assert.Equal(t, nil, g.RefreshWithOffset(tNow.Add(3*time.Second), time.Minute, m.Meta()))
+	m.Time = tNow.Add(2 * time.Second)
+	errStale := g.RecordMeasurement(m)
+	assert.NotEqual(t, nil, errStale)
+	assert.Contains(t, errStale.Error(), "stale")
+	m.Time = tNow.Add(4 * time.Second)
+	assert.Equal(t, nil, g.RecordMeasurement(m))
+
+	m.Leap = LEAP_ALARM
+	m.Time = tNow.Add(5 * time.Second)
+	assert.NotEqual(t, nil, g.RecordMeasurement(m))
+
+	//Refresher with measurement function
+	m.Leap = 0
+	m.Source = "http"
+	dut := OffsetRefresher{Gopher: &g, Measure: func() (SyncMeasurement, error) { return m, nil }}
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(6*time.Second)))
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_HTTP, Stratum: 2, ErrorEstimate: NsEpoch(10 * time.Millisecond)}, dut.meta())
+}
@@ -0,0 +1,274 @@
+/*
+Peer time exchange
+
+Devices in same vehicle or cabinet often have one synced unit and several unsynced ones.
+PeerExchange works over any io.ReadWriter (UDP, serial or pipe). Requester sends its state, peer answers with
+its TimeVariable, sync state and source quality. Unsynced requester records peer epoch + half round trip as
+uncertain sync with source SYNCSOURCE_PEER
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+)
+
+//magic(4)+version(1)+type(1)+flags(1)+source(1)+stratum(1)+reserved(3)+seq(4)+boot(4)+uptime(8)+epoch(8)+errorestimate(8)+crc32(4)
+const PEERMESSAGE_SIZE = 48
+
+const PEERMESSAGE_VERSION = 1
+
+var peerMagic = [4]byte{'T', 'G', 'P', 'X'}
+
+type PeerMessageType uint8
+
+const (
+	PEERMESSAGE_REQUEST PeerMessageType = iota + 1
+	PEERMESSAGE_RESPONSE
+)
+
+const peerFlagSynced = 1
+
+//PeerMessage is state of sender
+type PeerMessage struct {
+	Type   PeerMessageType
+	Seq    uint32 //Response echoes sequence number of request
+	Synced bool
+	Time   TimeVariable //Epoch is best guess if not synced
+	Meta   SyncMeta     //Source quality of latest certain sync
+}
+
+func (p *PeerMessage) ToBinary() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(peerMagic[:])
+	flags := byte(0)
+	if p.Synced {
+		flags |= peerFlagSynced
+	}
+	buf.Write([]byte{PEERMESSAGE_VERSION, byte(p.Type), flags, byte(p.Meta.Source), p.Meta.Stratum, 0, 0, 0})
+	binary.Write(buf, binary.LittleEndian, p.Seq)
+	binary.Write(buf, binary.LittleEndian, p.Time.BootNumber)
+	binary.Write(buf, binary.LittleEndian, p.Time.Uptime)
+	binary.Write(buf, binary.LittleEndian, p.Time.Epoch)
+	binary.Write(buf, binary.LittleEndian, p.Meta.ErrorEstimate)
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes()
+}
+
+func ParsePeerMessage(raw []byte) (PeerMessage, error) {
+	if len(raw) != PEERMESSAGE_SIZE {
+		return PeerMessage{}, fmt.Errorf("invalid peer message size %v", len(raw))
+	}
+	if !bytes.Equal(raw[0:4], peerMagic[:]) {
+		return PeerMessage{}, fmt.Errorf("invalid peer message magic %X", raw[0:4])
+	}
+	if crc32.ChecksumIEEE(raw[0:44]) != binary.LittleEndian.Uint32(raw[44:48]) {
+		return PeerMessage{}, fmt.Errorf("peer message crc error")
+	}
+	if raw[4] != PEERMESSAGE_VERSION {
+		return PeerMessage{}, fmt.Errorf("unsupported peer message version %v", raw[4])
+	}
+	return PeerMessage{
+		Type:   PeerMessageType(raw[5]),
+		Synced: raw[6]&peerFlagSynced != 0,
+		Meta: SyncMeta{
+			Source:        SyncSource(raw[7]),
+			Stratum:       raw[8],
+			ErrorEstimate: NsEpoch(binary.LittleEndian.Uint64(raw[36:44])),
+		},
+		Seq: binary.LittleEndian.Uint32(raw[12:16]),
+		Time: TimeVariable{
+			BootNumber: int32(binary.LittleEndian.Uint32(raw[16:20])),
+			Uptime:     NsUptime(binary.LittleEndian.Uint64(raw[20:28])),
+			Epoch:      NsEpoch(binary.LittleEndian.Uint64(raw[28:36])),
+		},
+	}, nil
+}
+
+//PeerSample is result of one exchange
+type PeerSample struct {
+	Peer     PeerMessage
+	RTT      time.Duration
+	Time     TimeVariable //Local boot and uptime when response arrived, epoch from peer with round trip compensation
+	Meta     SyncMeta     //Recorded metadata, peer quality with one hop and half round trip added
+	Recorded bool         //Recorded as uncertain sync
+}
+
+type PeerExchange struct {
+	Gopher *TimeGopher
+	Conn   io.ReadWriter
+	Lock   sync.Locker      //Optional, locked while using Gopher
+	Now    func() time.Time //Default time.Now
+
+	seq uint32
+	rx  []byte //Received bytes not yet parsed
+}
+
+func (p *PeerExchange) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+func (p *PeerExchange) lock() func() {
+	if p.Lock == nil {
+		return func() {}
+	}
+	p.Lock.Lock()
+	return p.Lock.Unlock
+}
+
+//state is own message
+func (p *PeerExchange) state(msgType PeerMessageType, seq uint32, t time.Time) (PeerMessage, error) {
+	defer p.lock()()
+	tv, errConvert := p.Gopher.Convert(t)
+	if errConvert != nil {
+		return PeerMessage{}, errConvert
+	}
+	meta, synced := p.Gopher.servedMeta()
+	if !synced {
+		guess, errGuess := p.Gopher.Unconvert(tv)
+		if errGuess == nil {
+			tv.Epoch = NsEpoch(guess.UnixNano())
+		}
+	}
+	return PeerMessage{Type: msgType, Seq: seq, Synced: synced, Time: tv, Meta: meta}, nil
+}
+
+//readFrame reads bytes until there is frame starting with magic. Bytes before magic are dropped
+func (p *PeerExchange) readFrame() ([]byte, error) {
+	buf := make([]byte, PEERMESSAGE_SIZE)
+	for {
+		start := bytes.Index(p.rx, peerMagic[:])
+		if start < 0 {
+			if len(peerMagic) <= len(p.rx) { //Keep tail that can be beginning of magic
+				p.rx = p.rx[len(p.rx)-len(peerMagic)+1:]
+			}
+		} else {
+			p.rx = p.rx[start:]
+			if PEERMESSAGE_SIZE <= len(p.rx) {
+				frame := p.rx[:PEERMESSAGE_SIZE:PEERMESSAGE_SIZE]
+				p.rx = p.rx[PEERMESSAGE_SIZE:]
+				return frame, nil
+			}
+		}
+		n, errRead := p.Conn.Read(buf)
+		p.rx = append(p.rx, buf[:n]...)
+		if errRead != nil {
+			return nil, errRead
+		}
+	}
+}
+
+//parseFrame parses frame. On error frame is returned to receive buffer without first byte, so next read resyncs to next magic
+func (p *PeerExchange) parseFrame(frame []byte) (PeerMessage, error) {
+	msg, errParse := ParsePeerMessage(frame)
+	if errParse != nil {
+		p.rx = append(frame[1:], p.rx...)
+	}
+	return msg, errParse
+}
+
+func (p *PeerExchange) read() (PeerMessage, error) {
+	frame, errRead := p.readFrame()
+	if errRead != nil {
+		return PeerMessage{}, errRead
+	}
+	return p.parseFrame(frame)
+}
+
+//answer writes response to request
+func (p *PeerExchange) answer(req PeerMessage) error {
+	resp, errResp := p.state(PEERMESSAGE_RESPONSE, req.Seq, p.now())
+	if errResp != nil {
+		return errResp
+	}
+	_, errWrite := p.Conn.Write(resp.ToBinary())
+	return errWrite
+}
+
+//ServeOne answers one request. Returns request so caller knows state of peer
+func (p *PeerExchange) ServeOne() (PeerMessage, error) {
+	req, errReq := p.read()
+	if errReq != nil {
+		return req, errReq
+	}
+	if req.Type != PEERMESSAGE_REQUEST {
+		return req, fmt.Errorf("expected peer request, got type %v", req.Type)
+	}
+	return req, p.answer(req)
+}
+
+//Serve answers requests until connection or answering fails. Invalid frames and other than requests are skipped
+func (p *PeerExchange) Serve() error {
+	for {
+		frame, errRead := p.readFrame()
+		if errRead != nil {
+			return errRead
+		}
+		req, errParse := p.parseFrame(frame)
+		if errParse != nil || req.Type != PEERMESSAGE_REQUEST {
+			continue
+		}
+		errAnswer := p.answer(req)
+		if errAnswer != nil {
+			return errAnswer
+		}
+	}
+}
+
+//Request asks state of peer. If this device is not synced and peer is, peer time is recorded as uncertain sync
+func (p *PeerExchange) Request() (PeerSample, error) {
+	p.seq++
+	t0 := p.now()
+	req, errReq := p.state(PEERMESSAGE_REQUEST, p.seq, t0)
+	if errReq != nil {
+		return PeerSample{}, errReq
+	}
+	_, errWrite := p.Conn.Write(req.ToBinary())
+	if errWrite != nil {
+		return PeerSample{}, errWrite
+	}
+	resp, errResp := p.read()
+	t1 := p.now()
+	if errResp != nil {
+		return PeerSample{}, errResp
+	}
+	if resp.Type != PEERMESSAGE_RESPONSE || resp.Seq != p.seq {
+		return PeerSample{Peer: resp}, fmt.Errorf("unexpected peer response type %v seq %v", resp.Type, resp.Seq)
+	}
+	rtt := t1.Sub(t0)
+	result := PeerSample{Peer: resp, RTT: rtt}
+	result.Meta = SyncMeta{
+		Source:        SYNCSOURCE_PEER,
+		Stratum:       resp.Meta.ServedStratum(),
+		ErrorEstimate: resp.Meta.ErrorEstimate + NsEpoch(rtt/2),
+	}
+
+	defer p.lock()()
+	tv, errConvert := p.Gopher.Convert(t1)
+	if errConvert != nil {
+		return result, errConvert
+	}
+	tv.Epoch = resp.Time.Epoch + NsEpoch(rtt/2)
+	result.Time = tv
+	if !resp.Synced || req.Synced {
+		return result, nil
+	}
+	if p.Gopher.UncertainRtcSyncLog == nil {
+		return result, fmt.Errorf("uncertain RTC sync log is not set")
+	}
+	errInsert := p.Gopher.insertSync(tv, false, result.Meta)
+	if errInsert != nil {
+		return result, errInsert
+	}
+	result.Recorded = true
+	return result, p.Gopher.syncLogs()
+}
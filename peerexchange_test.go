@@ -0,0 +1,117 @@
+package timegopher
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerMessageBinary(t *testing.T) {
+	msg := PeerMessage{Type: PEERMESSAGE_RESPONSE, Seq: 7, Synced: true, Time: TimeVariable{BootNumber: 3, Uptime: 1234, Epoch: TESTEPOCH0}, Meta: SyncMeta{Source: SYNCSOURCE_GPS, ErrorEstimate: 1000}}
+	raw := msg.ToBinary()
+	assert.Equal(t, PEERMESSAGE_SIZE, len(raw))
+	parsed, errParse := ParsePeerMessage(raw)
+	assert.Equal(t, nil, errParse)
+	assert.Equal(t, msg, parsed)
+
+	raw[20]++
+	_, errParse = ParsePeerMessage(raw)
+	assert.NotEqual(t, nil, errParse)
+}
+
+func TestPeerExchange(t *testing.T) {
+	tNow := time.Unix(0, TESTEPOCH0)
+
+	//Synced device, GPS source. Its clock is one hour ahead of unsynced device
+	rtcA, uncertainA, startA, stopA, lastA := testMemLogs()
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_SYNCRECORD, MaxRecords: 16}
+	memsto, errMem := memconf.InitMemLoop()
+	assert.Equal(t, nil, errMem)
+	metaA, _ := CreateSyncMetaDb(&memsto)
+	tA := tNow.Add(time.Hour)
+	confA := TimeGopherConf{TimeNow: tA, InSync: false, ColdStart: true, RtcSyncLog: rtcA, UncertainRtcSyncLog: uncertainA, StartLog: startA, StopLog: stopA, LastLog: lastA, UptimeCheck: testUptimeChecker(tA, 5000), SyncMetaLog: &metaA}
+	synced, errA := confA.Init()
+	assert.Equal(t, nil, errA)
+	assert.Equal(t, nil, synced.RefreshWithSource(tA, true, SyncMeta{Source: SYNCSOURCE_GPS, ErrorEstimate: NsEpoch(time.Millisecond)}))
+
+	rtcB, uncertainB, startB, stopB, lastB := testMemLogs()
+	unsynced, errB := NewTimeGopher(tNow, false, true, rtcB, uncertainB, startB, stopB, lastB, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errB)
+
+	connA, connB := net.Pipe()
+	defer connA.Close()
+	defer connB.Close()
+
+	//Both clocks advance 10ms during exchange
+	ticksA := []time.Time{tA.Add(5 * time.Millisecond)}
+	server := PeerExchange{Gopher: &synced, Conn: connA, Now: func() time.Time { return ticksA[0] }}
+	ticksB := []time.Time{tNow, tNow.Add(10 * time.Millisecond)}
+	client := PeerExchange{Gopher: &unsynced, Conn: connB, Now: func() time.Time {
+		result := ticksB[0]
+		ticksB = ticksB[1:]
+		return result
+	}}
+
+	served := make(chan PeerMessage, 1)
+	go func() {
+		req, errServe := server.ServeOne()
+		assert.Equal(t, nil, errServe)
+		served <- req
+	}()
+	sample, errReq := client.Request()
+	assert.Equal(t, nil, errReq)
+	req := <-served
+	assert.Equal(t, false, req.Synced)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000, Epoch: NsEpoch(tNow.UnixNano())}, req.Time)
+
+	assert.Equal(t, true, sample.Peer.Synced)
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_GPS, ErrorEstimate: NsEpoch(time.Millisecond)}, sample.Peer.Meta)
+	assert.Equal(t, 10*time.Millisecond, sample.RTT)
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_PEER, Stratum: 1, ErrorEstimate: NsEpoch(6 * time.Millisecond)}, sample.Meta)
+	assert.Equal(t, true, sample.Recorded)
+
+	entries, _ := uncertainB.All()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(10*time.Millisecond), Epoch: NsEpoch(tA.Add(10 * time.Millisecond).UnixNano())}, entries[1])
+
+	solved, errSolve := unsynced.SolveTime(1, 1000+NsUptime(time.Second))
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tA.Add(time.Second), solved)
+}
+
+func TestPeerExchangeResync(t *testing.T) {
+	tNow := time.Unix(0, TESTEPOCH0)
+	rtcA, uncertainA, startA, stopA, lastA := testMemLogs()
+	gopherA, errA := NewTimeGopher(tNow, true, true, rtcA, uncertainA, startA, stopA, lastA, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errA)
+	rtcB, uncertainB, startB, stopB, lastB := testMemLogs()
+	gopherB, errB := NewTimeGopher(tNow, true, true, rtcB, uncertainB, startB, stopB, lastB, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errB)
+
+	connA, connB := net.Pipe()
+	server := PeerExchange{Gopher: &gopherA, Conn: connA, Now: func() time.Time { return tNow }}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	//Garbage, frame with crc error and response are skipped
+	client := PeerExchange{Gopher: &gopherB, Conn: connB, Now: func() time.Time { return tNow }}
+	msg := PeerMessage{Type: PEERMESSAGE_REQUEST, Seq: 7}
+	corrupted := msg.ToBinary()
+	corrupted[20]++
+	msg.Type = PEERMESSAGE_RESPONSE
+	_, errWrite := connB.Write(append(append([]byte("garbageTG"), corrupted...), msg.ToBinary()...))
+	assert.Equal(t, nil, errWrite)
+
+	sample, errReq := client.Request()
+	assert.Equal(t, nil, errReq)
+	assert.Equal(t, uint32(1), sample.Peer.Seq)
+	assert.Equal(t, true, sample.Peer.Synced)
+
+	connB.Close()
+	assert.NotEqual(t, nil, <-served)
+}
@@ -0,0 +1,187 @@
+/*
+Pending queue
+
+Persistent queue for records that are stamped with TimeVariable (Convert) before wall clock time is known.
+Records are released with resolved wall clock time when there is certain RTC sync on their boot.
+
+Records on current boot wait until Timeout. Records on earlier boots can not get new sync entries, so those are
+released at once. Records released without certain sync have Uncertain flag set.
+Pushed records are appended to file, so queue survives restarts. File is compacted (rewritten with remaining
+records) when records are released. Partial record at end of file (push interrupted by power cut) is dropped at open.
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+)
+
+type PendingRecord struct {
+	Timestamp TimeVariable
+	Payload   []byte
+}
+
+type ReleasedRecord struct {
+	PendingRecord
+	Time      time.Time //Zero if time was not possible to solve at all
+	Uncertain bool      //Time is not from certain RTC sync
+}
+
+type PendingQueue struct {
+	filename string
+	Timeout  time.Duration //How long record can wait for certain sync on current boot
+	items    []PendingRecord
+}
+
+//OpenPendingQueue restores queue from file. File is created at first push
+func OpenPendingQueue(filename string, timeout time.Duration) (PendingQueue, error) {
+	result := PendingQueue{filename: filename, Timeout: timeout, items: []PendingRecord{}}
+	raw, errRead := os.ReadFile(filename)
+	if os.IsNotExist(errRead) {
+		return result, nil
+	}
+	if errRead != nil {
+		return result, fmt.Errorf("error reading pending queue %v err=%v", filename, errRead)
+	}
+	var errParse error
+	result.items, errParse = parsePendingRecords(raw)
+	if errParse != nil { //Interrupted append, keep complete records
+		errSave := result.save()
+		if errSave != nil {
+			return result, fmt.Errorf("error compacting pending queue %v after %v err=%v", filename, errParse, errSave)
+		}
+	}
+	return result, nil
+}
+
+func parsePendingRecords(raw []byte) ([]PendingRecord, error) {
+	result := []PendingRecord{}
+	for pos := 0; pos < len(raw); {
+		if len(raw) < pos+24 {
+			return result, fmt.Errorf("partial header at %v", pos)
+		}
+		rec := PendingRecord{Timestamp: TimeVariable{
+			BootNumber: int32(binary.LittleEndian.Uint32(raw[pos : pos+4])),
+			Uptime:     NsUptime(binary.LittleEndian.Uint64(raw[pos+4 : pos+12])),
+			Epoch:      NsEpoch(binary.LittleEndian.Uint64(raw[pos+12 : pos+20])),
+		}}
+		payloadLen := int(binary.LittleEndian.Uint32(raw[pos+20 : pos+24]))
+		pos += 24
+		if len(raw) < pos+payloadLen {
+			return result, fmt.Errorf("partial payload at %v", pos)
+		}
+		rec.Payload = append([]byte{}, raw[pos:pos+payloadLen]...)
+		pos += payloadLen
+		result = append(result, rec)
+	}
+	return result, nil
+}
+
+func (p *PendingRecord) writeTo(buf *bytes.Buffer) {
+	binary.Write(buf, binary.LittleEndian, p.Timestamp.BootNumber)
+	binary.Write(buf, binary.LittleEndian, p.Timestamp.Uptime)
+	binary.Write(buf, binary.LittleEndian, p.Timestamp.Epoch)
+	binary.Write(buf, binary.LittleEndian, uint32(len(p.Payload)))
+	buf.Write(p.Payload)
+}
+
+//save compacts queue by writing whole queue to file, copy on write
+func (p *PendingQueue) save() error {
+	buf := new(bytes.Buffer)
+	for _, rec := range p.items {
+		rec.writeTo(buf)
+	}
+	errWrite := writeFileSync(p.filename+"_TMP", buf.Bytes())
+	if errWrite != nil {
+		return errWrite
+	}
+	return os.Rename(p.filename+"_TMP", p.filename)
+}
+
+//Push adds record to queue. Timestamp is from TimeGopher.Convert
+func (p *PendingQueue) Push(timestamp TimeVariable, payload []byte) error {
+	if timestamp.Uptime <= 0 {
+		return fmt.Errorf("pending record must have uptime, got %#v", timestamp)
+	}
+	rec := PendingRecord{Timestamp: timestamp, Payload: append([]byte{}, payload...)}
+	buf := new(bytes.Buffer)
+	rec.writeTo(buf)
+	errAppend := appendFileSync(p.filename, buf.Bytes())
+	if errAppend != nil {
+		p.save() //Drop partially appended record if possible
+		return fmt.Errorf("error saving pending queue err=%v", errAppend)
+	}
+	p.items = append(p.items, rec)
+	return nil
+}
+
+//Len tells how many records are waiting
+func (p *PendingQueue) Len() int {
+	return len(p.items)
+}
+
+//Items gives records that are waiting, oldest first
+func (p *PendingQueue) Items() []PendingRecord {
+	return p.items
+}
+
+//resolve tells can record be released now and with what time
+func (p *PendingQueue) resolve(g *TimeGopher, rec PendingRecord, uptimeNow NsUptime) (ReleasedRecord, bool) {
+	result := ReleasedRecord{PendingRecord: rec}
+	if EPOCH70S <= rec.Timestamp.Epoch { //Was stamped when synced
+		result.Time = time.Unix(0, int64(rec.Timestamp.Epoch))
+		return result, true
+	}
+	epoch, errEpoch := g.RtcSyncLog.SolveEpoch(rec.Timestamp.BootNumber, rec.Timestamp.Uptime)
+	if errEpoch == nil {
+		result.Time = time.Unix(0, int64(epoch))
+		return result, true
+	}
+	if rec.Timestamp.BootNumber == g.bootNumber && uptimeNow < rec.Timestamp.Uptime+NsUptime(p.Timeout) {
+		return result, false //Still waiting
+	}
+	result.Uncertain = true
+	t, errTime := g.Unconvert(rec.Timestamp)
+	if errTime == nil {
+		result.Time = t
+	}
+	return result, true
+}
+
+//Release passes resolved records to handler in queue order and removes them from queue.
+//If handler returns error, releasing stops and that record stays in queue
+func (p *PendingQueue) Release(g *TimeGopher, tNow time.Time, handler func(rec ReleasedRecord) error) error {
+	uptimeNow, errUptime := g.UptimeCheck.UptimeNano(tNow)
+	if errUptime != nil {
+		return errUptime
+	}
+	remaining := []PendingRecord{}
+	var errHandler error
+	for _, rec := range p.items {
+		if errHandler != nil {
+			remaining = append(remaining, rec)
+			continue
+		}
+		released, ready := p.resolve(g, rec, uptimeNow)
+		if !ready {
+			remaining = append(remaining, rec)
+			continue
+		}
+		errHandler = handler(released)
+		if errHandler != nil {
+			remaining = append(remaining, rec)
+		}
+	}
+	if len(remaining) != len(p.items) {
+		p.items = remaining
+		errSave := p.save()
+		if errSave != nil {
+			return fmt.Errorf("error saving pending queue err=%v", errSave)
+		}
+	}
+	return errHandler
+}
@@ -0,0 +1,99 @@
+package timegopher
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingQueue(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+
+	fname := path.Join(t.TempDir(), "pending.queue")
+	dut, errOpen := OpenPendingQueue(fname, time.Hour)
+	assert.Equal(t, nil, errOpen)
+
+	oldBoot := TimeVariable{BootNumber: 0, Uptime: 5000}
+	tv0, _ := g.Convert(tNow.Add(time.Second))
+	assert.Equal(t, nil, dut.Push(oldBoot, []byte("old")))
+	assert.Equal(t, nil, dut.Push(tv0, []byte("first")))
+	assert.NotNil(t, dut.Push(TimeVariable{}, nil))
+
+	released := []ReleasedRecord{}
+	collect := func(rec ReleasedRecord) error {
+		released = append(released, rec)
+		return nil
+	}
+	assert.Equal(t, nil, dut.Release(&g, tNow.Add(time.Minute), collect))
+	assert.Equal(t, 1, len(released)) //Earlier boot can not be resolved anymore
+	assert.Equal(t, "old", string(released[0].Payload))
+	assert.Equal(t, true, released[0].Uncertain)
+
+	restored, errRestore := OpenPendingQueue(fname, time.Hour)
+	assert.Equal(t, nil, errRestore)
+	assert.Equal(t, []PendingRecord{{Timestamp: tv0, Payload: []byte("first")}}, restored.Items())
+
+	failing := func(rec ReleasedRecord) error { return fmt.Errorf("not now") }
+	assert.Equal(t, nil, g.Refresh(tNow.Add(2*time.Minute), true))
+	assert.NotNil(t, restored.Release(&g, tNow.Add(2*time.Minute), failing))
+	assert.Equal(t, 1, restored.Len())
+
+	released = []ReleasedRecord{}
+	assert.Equal(t, nil, restored.Release(&g, tNow.Add(2*time.Minute), collect))
+	assert.Equal(t, 0, restored.Len())
+	assert.Equal(t, false, released[0].Uncertain)
+	assert.Equal(t, tNow.Add(time.Second).UnixNano(), released[0].Time.UnixNano())
+}
+
+func TestPendingQueueTimeout(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, _ := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+
+	dut, _ := OpenPendingQueue(path.Join(t.TempDir(), "pending.queue"), time.Minute)
+	tv, _ := g.Convert(tNow)
+	assert.Equal(t, nil, dut.Push(tv, []byte("a")))
+
+	released := []ReleasedRecord{}
+	collect := func(rec ReleasedRecord) error {
+		released = append(released, rec)
+		return nil
+	}
+	assert.Equal(t, nil, dut.Release(&g, tNow.Add(time.Second), collect))
+	assert.Equal(t, 0, len(released))
+	assert.Equal(t, nil, dut.Release(&g, tNow.Add(2*time.Minute), collect))
+	assert.Equal(t, 1, len(released))
+	assert.Equal(t, true, released[0].Uncertain)
+	assert.Equal(t, tNow.UnixNano(), released[0].Time.UnixNano()) //Uncertain guess at start
+}
+
+func TestPendingQueueAppend(t *testing.T) {
+	fname := path.Join(t.TempDir(), "pending.queue")
+	dut, _ := OpenPendingQueue(fname, time.Minute)
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, nil, dut.Push(TimeVariable{BootNumber: 1, Uptime: NsUptime(i * 1000)}, []byte("abc")))
+		info, errStat := os.Stat(fname)
+		assert.Equal(t, nil, errStat)
+		assert.Equal(t, int64(i*27), info.Size())
+	}
+
+	//Push interrupted by power cut
+	f, _ := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND, 0666)
+	f.Write([]byte{1, 0, 0, 0, 2})
+	f.Close()
+	restored, errOpen := OpenPendingQueue(fname, time.Minute)
+	assert.Equal(t, nil, errOpen)
+	assert.Equal(t, 3, restored.Len())
+	assert.Equal(t, nil, restored.Push(TimeVariable{BootNumber: 1, Uptime: 4000}, []byte("d")))
+	restored, errOpen = OpenPendingQueue(fname, time.Minute)
+	assert.Equal(t, nil, errOpen)
+	assert.Equal(t, 4, restored.Len())
+	assert.Equal(t, []byte("d"), restored.Items()[3].Payload)
+}
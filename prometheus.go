@@ -0,0 +1,142 @@
+/*
+Prometheus text exposition of TimeGopher state
+
+WritePrometheus writes metrics in prometheus text format. Use it with node_exporter textfile collector
+or serve with PrometheusHandler. Metrics that can not be solved (like deviation when not synced) are left out.
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const PROMETHEUS_CONTENTTYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+//prometheusSample is one line of metric, labels formatted like {log="rtc"}
+type prometheusSample struct {
+	labels string
+	value  float64
+}
+
+func writePrometheusMetric(w io.Writer, name string, help string, metricType string, samples ...prometheusSample) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	if err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		_, err = fmt.Fprintf(w, "%s%s %v\n", name, sample.labels, sample.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//WritePrometheus writes current state in prometheus text format
+func (p *TimeGopher) WritePrometheus(w io.Writer, t time.Time) error {
+	synced := 0.0
+	if p.synced {
+		synced = 1
+	}
+	err := writePrometheusMetric(w, "timegopher_boot_number", "Current boot number", "gauge", prometheusSample{value: float64(p.bootNumber)})
+	if err != nil {
+		return err
+	}
+	err = writePrometheusMetric(w, "timegopher_synced", "Is wall clock synchronized (1) or not (0)", "gauge", prometheusSample{value: synced})
+	if err != nil {
+		return err
+	}
+
+	if p.synced {
+		deviation, errDeviation := p.RtcDeviation(t)
+		if errDeviation == nil {
+			err = writePrometheusMetric(w, "timegopher_rtc_deviation_seconds", "Deviation of wall clock from latest RTC sync", "gauge", prometheusSample{value: deviation.Seconds()})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	age, errAge := p.LastSyncAge(t)
+	if errAge == nil {
+		err = writePrometheusMetric(w, "timegopher_last_sync_age_seconds", "Time since latest certain RTC sync", "gauge", prometheusSample{value: age.Seconds()})
+		if err != nil {
+			return err
+		}
+	}
+
+	entries := []prometheusSample{}
+	logs := p.NamedLogs()
+	for _, name := range LOGNAMES {
+		db, haz := logs[name]
+		if !haz {
+			continue
+		}
+		n, errLen := db.Len()
+		if errLen != nil {
+			return fmt.Errorf("error getting %v log length err=%v", name, errLen)
+		}
+		entries = append(entries, prometheusSample{labels: fmt.Sprintf("{log=%q}", name), value: float64(n)})
+	}
+	err = writePrometheusMetric(w, "timegopher_log_entries", "Number of entries per log", "gauge", entries...)
+	if err != nil {
+		return err
+	}
+
+	if p.StartLog != nil {
+		restarts, errRestarts := p.SoftwareRestarts()
+		if errRestarts != nil {
+			return errRestarts
+		}
+		err = writePrometheusMetric(w, "timegopher_software_restarts", "Software restarts without reboot on current boot", "gauge", prometheusSample{value: float64(restarts)})
+		if err != nil {
+			return err
+		}
+	}
+	if p.StartLog != nil && p.CleanStopLog != nil {
+		crashes, errCrashes := p.DetectedCrashes()
+		if errCrashes != nil {
+			return errCrashes
+		}
+		err = writePrometheusMetric(w, "timegopher_detected_crashes", "Software restarts without reboot after run that was not stopped cleanly, on whole start log", "gauge", prometheusSample{value: float64(crashes)})
+		if err != nil {
+			return err
+		}
+	}
+
+	drift, errDrift := p.DriftPPM()
+	if errDrift == nil {
+		err = writePrometheusMetric(w, "timegopher_drift_ppm", "Estimated uptime drift compared to synced wall clock", "gauge", prometheusSample{value: drift})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//PrometheusHandler serves metrics over http. TimeGopher is not goroutine safe, set Lock if Refresh is called from other goroutine
+type PrometheusHandler struct {
+	Gopher *TimeGopher
+	Lock   sync.Locker //Optional
+}
+
+func (p *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.Lock != nil {
+		p.Lock.Lock()
+		defer p.Lock.Unlock()
+	}
+	var buf bytes.Buffer
+	err := p.Gopher.WritePrometheus(&buf, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", PROMETHEUS_CONTENTTYPE)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,102 @@
+package timegopher
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	_, errCreate := NewTimeGopher(tNow, true, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+
+	//Software restart 10s later on same boot, wall clock jumped and new sync entry is needed
+	tRestart := tNow.Add(10 * time.Second)
+	dut, errRestart := NewTimeGopher(tRestart, true, false, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errRestart)
+	assert.Equal(t, nil, rtc.Insert(TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(20*time.Second), Epoch: TESTEPOCH0 + NsEpoch(20*time.Second) + 1000}))
+
+	sessions, errSessions := dut.Sessions()
+	assert.Equal(t, nil, errSessions)
+	assert.Equal(t, 2, len(sessions))
+	assert.Equal(t, true, sessions[0].ColdStart)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000}, sessions[0].Stop)
+	assert.Equal(t, true, sessions[1].Running)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, dut.WritePrometheus(&buf, tNow.Add(30*time.Second)))
+	out := buf.String()
+	assert.Contains(t, out, "timegopher_boot_number 1\n")
+	assert.Contains(t, out, "timegopher_synced 1\n")
+	assert.Contains(t, out, "timegopher_last_sync_age_seconds 10\n")
+	assert.Contains(t, out, "timegopher_log_entries{log=\"rtc\"} 2\n")
+	assert.Contains(t, out, "timegopher_log_entries{log=\"start\"} 2\n")
+	assert.Contains(t, out, "timegopher_software_restarts 1\n")
+	assert.NotContains(t, out, "timegopher_detected_crashes") //CleanStopLog is not set
+	assert.Contains(t, out, "timegopher_drift_ppm ")
+	drift, errDrift := dut.DriftPPM()
+	assert.Equal(t, nil, errDrift)
+	assert.InDelta(t, 0.05, drift, 1e-9)
+
+	handler := PrometheusHandler{Gopher: &dut}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "# HELP timegopher_boot_number"))
+}
+
+func TestDetectedCrashes(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	cleanStop := CreateTimeMemDb(false)
+	tNow := time.Unix(0, TESTEPOCH0)
+	run := func(tStart time.Time, coldStart bool, uptimeCheck *UptimeChecker) TimeGopher {
+		conf := TimeGopherConf{TimeNow: tStart, ColdStart: coldStart, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last,
+			CleanStopLog: &cleanStop, UptimeCheck: uptimeCheck}
+		g, errCreate := conf.Init()
+		assert.Equal(t, nil, errCreate)
+		return g
+	}
+
+	g := run(tNow, true, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, g.Stop(tNow.Add(5*time.Second)))
+	//Restart after clean stop
+	g = run(tNow.Add(10*time.Second), false, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, g.Refresh(tNow.Add(15*time.Second), false))
+	//Restart after crash
+	g = run(tNow.Add(20*time.Second), false, testUptimeChecker(tNow, 1000))
+
+	sessions, errSessions := g.Sessions()
+	assert.Equal(t, nil, errSessions)
+	assert.Equal(t, 3, len(sessions))
+	assert.Equal(t, true, sessions[0].Clean)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(5*time.Second)}, sessions[0].Stop)
+	assert.Equal(t, false, sessions[1].Clean)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(15*time.Second)}, sessions[1].Stop)
+	stopLen, _ := stop.Len()
+	assert.Equal(t, 2, stopLen) //Init does not record clean stop again
+
+	crashes, errCrashes := g.DetectedCrashes()
+	assert.Equal(t, nil, errCrashes)
+	assert.Equal(t, 1, crashes)
+
+	//Reboot is not software crash
+	tReboot := tNow.Add(time.Hour)
+	g = run(tReboot, true, testUptimeChecker(tReboot, 1000))
+	crashes, errCrashes = g.DetectedCrashes()
+	assert.Equal(t, nil, errCrashes)
+	assert.Equal(t, 1, crashes)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, g.WritePrometheus(&buf, tReboot.Add(time.Second)))
+	assert.Contains(t, buf.String(), "timegopher_detected_crashes 1\n")
+
+	g.CleanStopLog = nil
+	_, errCrashes = g.DetectedCrashes()
+	assert.NotEqual(t, nil, errCrashes)
+}
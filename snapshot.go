@@ -0,0 +1,397 @@
+/*
+Snapshot of TimeGopher state
+
+Portable archive of all logs, boot number, sync state and configuration. Used for shipping time context with
+data uploads, reproducing field issues and migrating between storage backends.
+
+Format (little endian): magic "TGSN", version(1), flags(1), reserved(2), boot(4), RtcMaxDeviation(8),
+JumpThreshold(8), offset(8), then each log on LOGNAMES order as count(4)+entries and sha256 of all previous.
+Sync log entries have epoch (20 bytes), others are 12 bytes. Version 2 adds SyncMetaLog, ClockEventLog and JumpLog
+after logs as count(4)+32 byte records and CleanStopLog as count(4)+12 byte entries. Count 0xFFFFFFFF is log that
+was not set. Version 1 is still parsed
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const SNAPSHOT_VERSION = 2
+
+var snapshotMagic = [4]byte{'T', 'G', 'S', 'N'}
+
+const (
+	snapshotFlagSynced    = 1
+	snapshotFlagColdStart = 2
+)
+
+const snapshotHeaderSize = 36
+
+//Log was not set on TimeGopher
+const snapshotLogMissing = 0xFFFFFFFF
+
+//snapshotStoreRTC tells is epoch stored on log
+func snapshotStoreRTC(name string) bool {
+	return name == LOGNAME_RTC || name == LOGNAME_UNCERTAINRTC
+}
+
+type Snapshot struct {
+	BootNumber      int32
+	Synced          bool
+	ColdStart       bool
+	RtcMaxDeviation NsEpoch
+	JumpThreshold   NsEpoch
+	Offset          time.Duration
+	Logs            LogSet //Only logs that are set on TimeGopher
+
+	SyncRecords []SyncRecord     //Nil if SyncMetaLog is not set
+	ClockEvents []ClockEvent     //Nil if ClockEventLog is not set
+	Jumps       []ClockEvent     //Nil if JumpLog is not set
+	CleanStops  TimeVariableList //Nil if CleanStopLog is not set
+}
+
+//Snapshot takes copy of current state
+func (p *TimeGopher) Snapshot() (Snapshot, error) {
+	result := Snapshot{
+		BootNumber:      p.bootNumber,
+		Synced:          p.synced,
+		ColdStart:       p.coldStart,
+		RtcMaxDeviation: p.RtcMaxDeviation,
+		JumpThreshold:   p.JumpThreshold,
+		Offset:          p.offset,
+		Logs:            LogSet{},
+	}
+	for name, db := range p.NamedLogs() {
+		arr, errAll := db.All()
+		if errAll != nil {
+			return result, fmt.Errorf("reading %s log failed err=%v", name, errAll)
+		}
+		result.Logs[name] = append(TimeVariableList{}, arr...)
+	}
+	if p.SyncMetaLog != nil {
+		arr, errAll := p.SyncMetaLog.All()
+		if errAll != nil {
+			return result, fmt.Errorf("reading sync meta log failed err=%v", errAll)
+		}
+		result.SyncRecords = append([]SyncRecord{}, arr...)
+	}
+	if p.ClockEventLog != nil {
+		arr, errAll := p.ClockEventLog.All()
+		if errAll != nil {
+			return result, fmt.Errorf("reading clock event log failed err=%v", errAll)
+		}
+		result.ClockEvents = append([]ClockEvent{}, arr...)
+	}
+	if p.JumpLog != nil {
+		arr, errAll := p.JumpLog.All()
+		if errAll != nil {
+			return result, fmt.Errorf("reading jump log failed err=%v", errAll)
+		}
+		result.Jumps = append([]ClockEvent{}, arr...)
+	}
+	if p.CleanStopLog != nil {
+		arr, errAll := p.CleanStopLog.All()
+		if errAll != nil {
+			return result, fmt.Errorf("reading clean stop log failed err=%v", errAll)
+		}
+		result.CleanStops = append(TimeVariableList{}, arr...)
+	}
+	return result, nil
+}
+
+//writeSnapshotRecords writes count and records, or missing count if records is nil
+func writeSnapshotRecords[T any](buf *bytes.Buffer, name string, records []T, toBinary func(T) ([]byte, error)) error {
+	if records == nil {
+		return binary.Write(buf, binary.LittleEndian, uint32(snapshotLogMissing))
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(len(records)))
+	for _, rec := range records {
+		bin, errBin := toBinary(rec)
+		if errBin != nil {
+			return fmt.Errorf("%s entry %#v err=%v", name, rec, errBin)
+		}
+		buf.Write(bin)
+	}
+	return nil
+}
+
+//parseSnapshotRecords parses records of size starting from pos. Returns position after records
+func parseSnapshotRecords[T any](content []byte, pos int, name string, size int, parse func([]byte) (T, error)) ([]T, int, error) {
+	if len(content) < pos+4 {
+		return nil, pos, fmt.Errorf("snapshot truncated at %s", name)
+	}
+	count := binary.LittleEndian.Uint32(content[pos : pos+4])
+	pos += 4
+	if count == snapshotLogMissing {
+		return nil, pos, nil
+	}
+	if len(content) < pos+int(count)*size {
+		return nil, pos, fmt.Errorf("snapshot truncated at %s, %v entries", name, count)
+	}
+	result := make([]T, count)
+	for i := range result {
+		var errParse error
+		result[i], errParse = parse(content[pos : pos+size])
+		if errParse != nil {
+			return nil, pos, fmt.Errorf("%s parse error %v", name, errParse)
+		}
+		pos += size
+	}
+	return result, pos, nil
+}
+
+func syncRecordToBinary(rec SyncRecord) ([]byte, error) {
+	return rec.ToBinary()
+}
+
+func clockEventToBinary(e ClockEvent) ([]byte, error) {
+	return e.ToBinary()
+}
+
+func cleanStopToBinary(tv TimeVariable) ([]byte, error) {
+	return tv.ToBinary(false)
+}
+
+func parseCleanStop(raw []byte) (TimeVariable, error) {
+	return ParseTimeVariable(raw, false)
+}
+
+func (p *Snapshot) ToBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Write(snapshotMagic[:])
+	flags := byte(0)
+	if p.Synced {
+		flags |= snapshotFlagSynced
+	}
+	if p.ColdStart {
+		flags |= snapshotFlagColdStart
+	}
+	buf.Write([]byte{SNAPSHOT_VERSION, flags, 0, 0})
+	binary.Write(buf, binary.LittleEndian, p.BootNumber)
+	binary.Write(buf, binary.LittleEndian, p.RtcMaxDeviation)
+	binary.Write(buf, binary.LittleEndian, p.JumpThreshold)
+	binary.Write(buf, binary.LittleEndian, int64(p.Offset))
+	for _, name := range LOGNAMES {
+		arr, found := p.Logs[name]
+		if !found {
+			binary.Write(buf, binary.LittleEndian, uint32(snapshotLogMissing))
+			continue
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(arr)))
+		for _, tv := range arr {
+			bin, errBin := tv.ToBinary(snapshotStoreRTC(name))
+			if errBin != nil {
+				return nil, fmt.Errorf("%s log entry %#v err=%v", name, tv, errBin)
+			}
+			buf.Write(bin)
+		}
+	}
+	errWrite := writeSnapshotRecords(buf, "sync meta log", p.SyncRecords, syncRecordToBinary)
+	if errWrite == nil {
+		errWrite = writeSnapshotRecords(buf, "clock event log", p.ClockEvents, clockEventToBinary)
+	}
+	if errWrite == nil {
+		errWrite = writeSnapshotRecords(buf, "jump log", p.Jumps, clockEventToBinary)
+	}
+	if errWrite == nil {
+		errWrite = writeSnapshotRecords(buf, "clean stop log", p.CleanStops, cleanStopToBinary)
+	}
+	if errWrite != nil {
+		return nil, errWrite
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+func ParseSnapshot(raw []byte) (Snapshot, error) {
+	if len(raw) < snapshotHeaderSize+sha256.Size {
+		return Snapshot{}, fmt.Errorf("snapshot too short %v bytes", len(raw))
+	}
+	if !bytes.Equal(raw[0:4], snapshotMagic[:]) {
+		return Snapshot{}, fmt.Errorf("invalid snapshot magic %X", raw[0:4])
+	}
+	content := raw[:len(raw)-sha256.Size]
+	sum := sha256.Sum256(content)
+	if !bytes.Equal(sum[:], raw[len(content):]) {
+		return Snapshot{}, fmt.Errorf("snapshot checksum error")
+	}
+	if raw[4] != 1 && raw[4] != SNAPSHOT_VERSION {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %v", raw[4])
+	}
+	result := Snapshot{
+		Synced:          raw[5]&snapshotFlagSynced != 0,
+		ColdStart:       raw[5]&snapshotFlagColdStart != 0,
+		BootNumber:      int32(binary.LittleEndian.Uint32(raw[8:12])),
+		RtcMaxDeviation: NsEpoch(binary.LittleEndian.Uint64(raw[12:20])),
+		JumpThreshold:   NsEpoch(binary.LittleEndian.Uint64(raw[20:28])),
+		Offset:          time.Duration(binary.LittleEndian.Uint64(raw[28:36])),
+		Logs:            LogSet{},
+	}
+	pos := snapshotHeaderSize
+	for _, name := range LOGNAMES {
+		if len(content) < pos+4 {
+			return result, fmt.Errorf("snapshot truncated at %s log", name)
+		}
+		count := binary.LittleEndian.Uint32(content[pos : pos+4])
+		pos += 4
+		if count == snapshotLogMissing {
+			continue
+		}
+		size := int(count) * RECORDSIZE_TIMEVARIABLE_NORTC
+		if snapshotStoreRTC(name) {
+			size = int(count) * RECORDSIZE_TIMEVARIABLE_RTC
+		}
+		if len(content) < pos+size {
+			return result, fmt.Errorf("snapshot truncated at %s log, %v entries", name, count)
+		}
+		arr, errParse := ParseTimeVariableList(content[pos:pos+size], snapshotStoreRTC(name))
+		if errParse != nil {
+			return result, fmt.Errorf("%s log parse error %v", name, errParse)
+		}
+		result.Logs[name] = arr
+		pos += size
+	}
+	if raw[4] == SNAPSHOT_VERSION {
+		var errParse error
+		result.SyncRecords, pos, errParse = parseSnapshotRecords(content, pos, "sync meta log", RECORDSIZE_SYNCRECORD, ParseSyncRecord)
+		if errParse == nil {
+			result.ClockEvents, pos, errParse = parseSnapshotRecords(content, pos, "clock event log", RECORDSIZE_CLOCKEVENT, ParseClockEvent)
+		}
+		if errParse == nil {
+			result.Jumps, pos, errParse = parseSnapshotRecords(content, pos, "jump log", RECORDSIZE_CLOCKEVENT, ParseClockEvent)
+		}
+		if errParse == nil {
+			var cleanStops []TimeVariable
+			cleanStops, pos, errParse = parseSnapshotRecords(content, pos, "clean stop log", RECORDSIZE_TIMEVARIABLE_NORTC, parseCleanStop)
+			result.CleanStops = TimeVariableList(cleanStops)
+		}
+		if errParse != nil {
+			return result, errParse
+		}
+	}
+	if pos != len(content) {
+		return result, fmt.Errorf("snapshot have %v extra bytes", len(content)-pos)
+	}
+	return result, nil
+}
+
+//ExportSnapshot writes snapshot of current state
+func (p *TimeGopher) ExportSnapshot(w io.Writer) error {
+	snap, errSnap := p.Snapshot()
+	if errSnap != nil {
+		return errSnap
+	}
+	bin, errBin := snap.ToBinary()
+	if errBin != nil {
+		return errBin
+	}
+	_, errWrite := w.Write(bin)
+	return errWrite
+}
+
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	raw, errRead := io.ReadAll(r)
+	if errRead != nil {
+		return Snapshot{}, errRead
+	}
+	return ParseSnapshot(raw)
+}
+
+/*
+Restore writes logs to logs of conf and creates TimeGopher with state of snapshot. Logs on conf must be empty.
+Sync meta, clock event, jump and clean stop records are written to SyncMetaLog, ClockEventLog, JumpLog and CleanStopLog of conf.
+Optional features (UptimeCheck, SyncMetaLog, SyncProbe, BootCounters etc..) are taken from conf. TimeNow, InSync and ColdStart are not used
+*/
+func (p *Snapshot) Restore(conf TimeGopherConf) (TimeGopher, error) {
+	result, errNew := conf.newTimeGopher()
+	if errNew != nil {
+		return result, errNew
+	}
+	result.synced = p.Synced
+	result.offset = p.Offset
+	result.RtcMaxDeviation = p.RtcMaxDeviation
+	result.JumpThreshold = p.JumpThreshold
+	result.coldStart = p.ColdStart
+	result.bootNumber = p.BootNumber
+
+	targets := result.NamedLogs()
+	for _, name := range LOGNAMES {
+		arr := p.Logs[name]
+		if len(arr) == 0 {
+			continue
+		}
+		db, found := targets[name]
+		if !found {
+			return result, fmt.Errorf("no target for %s log with %v entries", name, len(arr))
+		}
+		n, errLen := db.Len()
+		if errLen != nil {
+			return result, errLen
+		}
+		if n != 0 {
+			return result, fmt.Errorf("%s log is not empty, have %v entries", name, n)
+		}
+		for _, tv := range arr {
+			errInsert := db.Insert(tv)
+			if errInsert != nil {
+				return result, fmt.Errorf("restoring %s log entry %#v failed err=%v", name, tv, errInsert)
+			}
+		}
+	}
+	errRestore := restoreSnapshotRecords(conf.SyncMetaLog, "sync meta", p.SyncRecords)
+	if errRestore == nil {
+		errRestore = restoreSnapshotRecords(conf.ClockEventLog, "clock event", p.ClockEvents)
+	}
+	if errRestore == nil {
+		errRestore = restoreSnapshotRecords(conf.JumpLog, "jump", p.Jumps)
+	}
+	if errRestore == nil {
+		errRestore = restoreSnapshotRecords[TimeVariable](result.CleanStopLog, "clean stop", p.CleanStops)
+	}
+	if errRestore != nil {
+		return result, errRestore
+	}
+	if 0 < len(conf.BootCounters) { //Same voting as Init, restored logs are on snapshot boot number
+		result.bootVote = VoteBootNumber(p.BootNumber, conf.BootCounters)
+		result.bootNumber = result.bootVote.Boot
+		result.writeBootCounters(conf.BootCounters)
+	}
+	return result, result.syncLogs()
+}
+
+//snapshotRecordLog is common part of SyncMetaLog and ClockEventLog
+type snapshotRecordLog[T any] interface {
+	Insert(rec T) error
+	All() ([]T, error)
+}
+
+//restoreSnapshotRecords writes records to empty log. Nil target is error only if there are records
+func restoreSnapshotRecords[T any](db snapshotRecordLog[T], name string, records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if db == nil {
+		return fmt.Errorf("no target for %s log with %v entries", name, len(records))
+	}
+	arr, errAll := db.All()
+	if errAll != nil {
+		return errAll
+	}
+	if len(arr) != 0 {
+		return fmt.Errorf("%s log is not empty, have %v entries", name, len(arr))
+	}
+	for _, rec := range records {
+		errInsert := db.Insert(rec)
+		if errInsert != nil {
+			return fmt.Errorf("restoring %s log entry %#v failed err=%v", name, rec, errInsert)
+		}
+	}
+	return nil
+}
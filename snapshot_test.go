@@ -0,0 +1,154 @@
+package timegopher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+	assert.Equal(t, nil, g.RefreshWithOffset(tNow.Add(time.Minute), time.Second, SyncMeta{}))
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, g.ExportSnapshot(&buf))
+	raw := append([]byte{}, buf.Bytes()...)
+
+	snap, errRead := ReadSnapshot(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, int32(1), snap.BootNumber)
+	assert.Equal(t, true, snap.Synced)
+	assert.Equal(t, true, snap.ColdStart)
+	assert.Equal(t, time.Second, snap.Offset)
+	assert.Equal(t, 5, len(snap.Logs))
+	orig, _ := g.Snapshot()
+	assert.Equal(t, orig, snap)
+
+	//Restore to fresh storage
+	rtc2, uncertain2, start2, stop2, last2 := testMemLogs()
+	restored, errRestore := snap.Restore(TimeGopherConf{RtcSyncLog: rtc2, UncertainRtcSyncLog: uncertain2, StartLog: start2, StopLog: stop2, LastLog: last2, UptimeCheck: testUptimeChecker(tNow, 1000)})
+	assert.Equal(t, nil, errRestore)
+	restoredSnap, _ := restored.Snapshot()
+	assert.Equal(t, snap, restoredSnap)
+	solved, errSolve := restored.SolveTime(1, 1000+NsUptime(2*time.Minute))
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tNow.Add(2*time.Minute+time.Second), solved)
+
+	//Optional features are set like on Init
+	rtc4, uncertain4, start4, stop4, last4 := testMemLogs()
+	counter := testBootCounter{}
+	restored, errRestore = snap.Restore(TimeGopherConf{RtcSyncLog: rtc4, UncertainRtcSyncLog: uncertain4, StartLog: start4, StopLog: stop4, LastLog: last4, UptimeCheck: testUptimeChecker(tNow, 1000),
+		BootCounters: []BootCounterStore{&counter}, OnCorrection: func(corrections []EpochCorrection) {}})
+	assert.Equal(t, nil, errRestore)
+	assert.Equal(t, int32(1), restored.BootCounterVote().Boot)
+	assert.Equal(t, int32(1), counter.boot)
+	assert.NotNil(t, restored.OnCorrection)
+
+	//Not empty anymore
+	_, errRestore = snap.Restore(TimeGopherConf{RtcSyncLog: rtc2, UncertainRtcSyncLog: uncertain2, StartLog: start2, StopLog: stop2, LastLog: last2})
+	assert.NotEqual(t, nil, errRestore)
+	//No target for logs
+	rtc3, _, _, _, _ := testMemLogs()
+	_, errRestore = snap.Restore(TimeGopherConf{RtcSyncLog: rtc3})
+	assert.NotEqual(t, nil, errRestore)
+
+	raw[40]++
+	_, errParse := ParseSnapshot(raw)
+	assert.NotEqual(t, nil, errParse)
+	_, errParse = ParseSnapshot(raw[:20])
+	assert.NotEqual(t, nil, errParse)
+}
+
+func testSnapshotEventLogs(t *testing.T) (*SyncMetaDb, *ClockEventDb, *ClockEventDb) {
+	metaconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_SYNCRECORD, MaxRecords: 16}
+	metasto, errMeta := metaconf.InitMemLoop()
+	assert.Equal(t, nil, errMeta)
+	meta, errMetaDb := CreateSyncMetaDb(&metasto)
+	assert.Equal(t, nil, errMetaDb)
+
+	eventconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_CLOCKEVENT, MaxRecords: 16}
+	eventsto, _ := eventconf.InitMemLoop()
+	events, errEvents := CreateClockEventDb(&eventsto)
+	assert.Equal(t, nil, errEvents)
+	jumpsto, _ := eventconf.InitMemLoop()
+	jumps, errJumps := CreateClockEventDb(&jumpsto)
+	assert.Equal(t, nil, errJumps)
+	return &meta, &events, &jumps
+}
+
+func TestSnapshotEventLogs(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	meta, events, jumps := testSnapshotEventLogs(t)
+	cleanStop := CreateTimeMemDb(false)
+	gconf := TimeGopherConf{TimeNow: tNow, ColdStart: true, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last,
+		CleanStopLog: &cleanStop, UptimeCheck: testUptimeChecker(tNow, 1000), SyncMetaLog: meta, ClockEventLog: events, JumpLog: jumps}
+	g, errCreate := gconf.Init()
+	assert.Equal(t, nil, errCreate)
+	assert.Equal(t, nil, g.DoUncertainTimeSyncWithSource(tNow.Add(time.Minute), SyncMeta{Source: SYNCSOURCE_NTP, Stratum: 2, ErrorEstimate: 1000}))
+	assert.Equal(t, nil, events.Insert(ClockEvent{Kind: CLOCKEVENT_STEP, BootNumber: 1, Uptime: 2000, Before: TESTEPOCH0, After: TESTEPOCH0 + 5000}))
+	assert.Equal(t, nil, jumps.Insert(ClockEvent{Kind: CLOCKEVENT_JUMPFORWARD, BootNumber: 1, Uptime: 3000, Before: TESTEPOCH0, After: TESTEPOCH0 + 9000}))
+	assert.Equal(t, nil, g.Stop(tNow.Add(2*time.Minute)))
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, g.ExportSnapshot(&buf))
+	snap, errRead := ReadSnapshot(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, 2, len(snap.SyncRecords)) //Init and sync
+	synced := snap.SyncRecords[len(snap.SyncRecords)-1]
+	assert.Equal(t, SYNCSOURCE_NTP, synced.Source)
+	assert.Equal(t, 1, len(snap.ClockEvents))
+	assert.Equal(t, 1, len(snap.Jumps))
+	assert.Equal(t, TimeVariableList{{BootNumber: 1, Uptime: 1000 + NsUptime(2*time.Minute)}}, snap.CleanStops)
+	orig, _ := g.Snapshot()
+	assert.Equal(t, orig, snap)
+
+	rtc2, uncertain2, start2, stop2, last2 := testMemLogs()
+	meta2, events2, jumps2 := testSnapshotEventLogs(t)
+	cleanStop2 := CreateTimeMemDb(false)
+	conf := TimeGopherConf{RtcSyncLog: rtc2, UncertainRtcSyncLog: uncertain2, StartLog: start2, StopLog: stop2, LastLog: last2, CleanStopLog: &cleanStop2,
+		UptimeCheck: testUptimeChecker(tNow, 1000), SyncMetaLog: meta2, ClockEventLog: events2, JumpLog: jumps2}
+	restored, errRestore := snap.Restore(conf)
+	assert.Equal(t, nil, errRestore)
+	restoredSnap, _ := restored.Snapshot()
+	assert.Equal(t, snap, restoredSnap)
+	found, ok, errFind := meta2.Find(synced.TimeVariable, synced.Certain)
+	assert.Equal(t, nil, errFind)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, uint8(2), found.Stratum)
+
+	//Not empty anymore
+	rtc3, uncertain3, start3, stop3, last3 := testMemLogs()
+	_, errRestore = snap.Restore(TimeGopherConf{RtcSyncLog: rtc3, UncertainRtcSyncLog: uncertain3, StartLog: start3, StopLog: stop3, LastLog: last3, JumpLog: jumps2})
+	assert.NotEqual(t, nil, errRestore)
+	//No target for jumps
+	rtc4, uncertain4, start4, stop4, last4 := testMemLogs()
+	meta4, events4, _ := testSnapshotEventLogs(t)
+	_, errRestore = snap.Restore(TimeGopherConf{RtcSyncLog: rtc4, UncertainRtcSyncLog: uncertain4, StartLog: start4, StopLog: stop4, LastLog: last4, SyncMetaLog: meta4, ClockEventLog: events4})
+	assert.NotEqual(t, nil, errRestore)
+}
+
+func TestSnapshotVersion1(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	g, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+	snap, _ := g.Snapshot()
+	raw, errBin := snap.ToBinary()
+	assert.Equal(t, nil, errBin)
+
+	//Version 1 did not have sections of sync meta, clock event, jump and clean stop logs
+	content := append([]byte{}, raw[:len(raw)-sha256.Size-4*4]...)
+	content[4] = 1
+	sum := sha256.Sum256(content)
+	parsed, errParse := ParseSnapshot(append(content, sum[:]...))
+	assert.Equal(t, nil, errParse)
+	assert.Equal(t, snap, parsed)
+}
@@ -0,0 +1,153 @@
+/*
+Statistics from TimeGopher logs
+
+Helper functions for diagnostics and metrics. Software runs (sessions) are resolved from start and stop logs.
+Crashes are detected from clean stop log written by Stop.
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"time"
+)
+
+//Session is one software run
+type Session struct {
+	Start     TimeVariable
+	Stop      TimeVariable //Last known alive situation. Zero if not known
+	ColdStart bool         //First run on boot
+	Running   bool         //Current run
+	Clean     bool         //Stopped by Stop. Needs CleanStopLog
+}
+
+//Sessions lists software runs from start log, oldest first. Stop is taken from stop log (recorded at next start)
+func (p *TimeGopher) Sessions() ([]Session, error) {
+	if p.StartLog == nil {
+		return nil, fmt.Errorf("StartLog is not set")
+	}
+	starts, errStarts := p.StartLog.All()
+	if errStarts != nil {
+		return nil, errStarts
+	}
+	stops := []TimeVariable{}
+	if p.StopLog != nil {
+		var errStops error
+		stops, errStops = p.StopLog.All()
+		if errStops != nil {
+			return nil, errStops
+		}
+	}
+
+	cleanStops := []TimeVariable{}
+	if p.CleanStopLog != nil {
+		var errCleanStops error
+		cleanStops, errCleanStops = p.CleanStopLog.All()
+		if errCleanStops != nil {
+			return nil, errCleanStops
+		}
+	}
+
+	result := make([]Session, len(starts))
+	stopIndex := 0
+	cleanIndex := 0
+	for i, start := range starts {
+		result[i] = Session{Start: start, ColdStart: i == 0 || starts[i-1].BootNumber != start.BootNumber}
+		for stopIndex < len(stops) && !stops[stopIndex].After(start) && !stops[stopIndex].Equal(start) {
+			stopIndex++ //Stop before this run, belongs to run not in log anymore
+		}
+		for stopIndex < len(stops) && (i == len(starts)-1 || stops[stopIndex].Before(starts[i+1])) {
+			result[i].Stop = stops[stopIndex] //Latest stop before next start
+			stopIndex++
+		}
+		for cleanIndex < len(cleanStops) && !cleanStops[cleanIndex].After(start) {
+			cleanIndex++
+		}
+		for cleanIndex < len(cleanStops) && (i == len(starts)-1 || cleanStops[cleanIndex].Before(starts[i+1])) {
+			result[i].Clean = true
+			cleanIndex++
+		}
+	}
+	if 0 < len(result) && result[len(result)-1].Start.BootNumber == p.bootNumber {
+		result[len(result)-1].Running = true
+	}
+	return result, nil
+}
+
+//SoftwareRestarts counts warm starts (software started again without reboot) on current boot
+func (p *TimeGopher) SoftwareRestarts() (int, error) {
+	sessions, errSessions := p.Sessions()
+	if errSessions != nil {
+		return 0, errSessions
+	}
+	result := 0
+	for _, s := range sessions {
+		if s.Start.BootNumber == p.bootNumber && !s.ColdStart {
+			result++
+		}
+	}
+	return result, nil
+}
+
+//DetectedCrashes counts warm starts (software started again without reboot) where previous run was not stopped by Stop.
+//Crashes before reboot are not detected
+func (p *TimeGopher) DetectedCrashes() (int, error) {
+	if p.CleanStopLog == nil {
+		return 0, fmt.Errorf("CleanStopLog is not set")
+	}
+	sessions, errSessions := p.Sessions()
+	if errSessions != nil {
+		return 0, errSessions
+	}
+	result := 0
+	for i := 1; i < len(sessions); i++ {
+		if !sessions[i].ColdStart && !sessions[i-1].Clean {
+			result++
+		}
+	}
+	return result, nil
+}
+
+//LastSyncAge tells how long ago latest certain RTC sync was done
+func (p *TimeGopher) LastSyncAge(t time.Time) (time.Duration, error) {
+	arr, errArr := p.RtcSyncLog.GetLatestN(1)
+	if errArr != nil {
+		return 0, errArr
+	}
+	if len(arr) == 0 {
+		return 0, fmt.Errorf("no sync entries")
+	}
+	tNow, errNow := p.Convert(t)
+	if errNow != nil {
+		return 0, errNow
+	}
+	if arr[0].BootNumber == tNow.BootNumber {
+		return time.Duration(tNow.Uptime - arr[0].Uptime), nil
+	}
+	tSolved, errSolved := p.Unconvert(tNow)
+	if errSolved != nil {
+		return 0, fmt.Errorf("sync on earlier boot and current time is not known err=%v", errSolved)
+	}
+	return time.Duration(NsEpoch(tSolved.UnixNano()) - arr[0].Epoch), nil
+}
+
+//DriftPPM estimates how much uptime drifts from synced wall clock time. Uses first and last certain sync entry on latest boot having at least two entries
+func (p *TimeGopher) DriftPPM() (float64, error) {
+	all, errAll := p.RtcSyncLog.All()
+	if errAll != nil {
+		return 0, errAll
+	}
+	lst := TimeVariableList(all)
+	for i := len(lst) - 1; 0 < i; i-- {
+		inBoot := lst.GetVariablesInBoot(lst[i].BootNumber)
+		if 2 <= len(inBoot) {
+			first := inBoot[0]
+			last := inBoot[len(inBoot)-1]
+			dUptime := float64(last.Uptime - first.Uptime)
+			dEpoch := float64(last.Epoch - first.Epoch)
+			return (dEpoch - dUptime) / dUptime * 1000 * 1000, nil
+		}
+		i -= len(inBoot) - 1 //Skip rest of this boot
+	}
+	return 0, fmt.Errorf("not enough sync entries on same boot for estimating drift")
+}
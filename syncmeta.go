@@ -0,0 +1,293 @@
+/*
+Sync source and quality metadata
+
+RtcSyncLog and UncertainRtcSyncLog entries are plain TimeVariables. SyncMetaLog keeps extra record per sync entry
+telling where time came from (NTP, GPS etc..), stratum and estimated error.
+If TimeGopher have SyncMetaLog, conversions prefer better source instead of always choosing certain sync.
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hjkoskel/fixregsto"
+)
+
+type SyncSource uint8
+
+const (
+	SYNCSOURCE_UNKNOWN SyncSource = iota
+	SYNCSOURCE_NTP
+	SYNCSOURCE_GPS
+	SYNCSOURCE_RTC //Battery backed hardware RTC
+	SYNCSOURCE_MANUAL
+	SYNCSOURCE_PEER
+	SYNCSOURCE_CELLULAR
+	SYNCSOURCE_HTTP //Date header of http response
+)
+
+var syncSourceNames = map[SyncSource]string{
+	SYNCSOURCE_UNKNOWN:  "unknown",
+	SYNCSOURCE_NTP:      "ntp",
+	SYNCSOURCE_GPS:      "gps",
+	SYNCSOURCE_RTC:      "rtc",
+	SYNCSOURCE_MANUAL:   "manual",
+	SYNCSOURCE_PEER:     "peer",
+	SYNCSOURCE_CELLULAR: "cellular",
+	SYNCSOURCE_HTTP:     "http",
+}
+
+//Bigger is better, used if error estimates are not available
+var syncSourceRank = map[SyncSource]int{
+	SYNCSOURCE_UNKNOWN:  0,
+	SYNCSOURCE_MANUAL:   1,
+	SYNCSOURCE_RTC:      2,
+	SYNCSOURCE_HTTP:     3,
+	SYNCSOURCE_PEER:     4,
+	SYNCSOURCE_CELLULAR: 5,
+	SYNCSOURCE_NTP:      6,
+	SYNCSOURCE_GPS:      7,
+}
+
+func (p SyncSource) String() string {
+	s, haz := syncSourceNames[p]
+	if !haz {
+		return fmt.Sprintf("source%v", uint8(p))
+	}
+	return s
+}
+
+//ParseSyncSource parses name given by String(). Unknown names give SYNCSOURCE_UNKNOWN
+func ParseSyncSource(s string) SyncSource {
+	for source, name := range syncSourceNames {
+		if name == s {
+			return source
+		}
+	}
+	return SYNCSOURCE_UNKNOWN
+}
+
+//SyncMeta tells how sync entry was got
+type SyncMeta struct {
+	Source        SyncSource
+	Stratum       uint8   //NTP stratum or other quality value, lower is better. 0 if not known
+	ErrorEstimate NsEpoch //Estimated error of epoch. 0 if not known
+}
+
+//SyncRecord is metadata of one sync entry. Certain tells is entry on RtcSyncLog or on UncertainRtcSyncLog
+type SyncRecord struct {
+	TimeVariable
+	SyncMeta
+	Certain bool
+}
+
+//boot(4)+uptime(8)+epoch(8)+source(1)+stratum(1)+certain(1)+reserved(1)+error(8)
+const RECORDSIZE_SYNCRECORD = 32
+
+//better tells is p better than ref. Certain flags are used if there is no other difference
+func (p SyncMeta) better(certain bool, ref SyncMeta, refCertain bool) bool {
+	if 0 < p.ErrorEstimate && 0 < ref.ErrorEstimate && p.ErrorEstimate != ref.ErrorEstimate {
+		return p.ErrorEstimate < ref.ErrorEstimate
+	}
+	rank := p.rank(certain)
+	refRank := ref.rank(refCertain)
+	if rank != refRank {
+		return refRank < rank
+	}
+	if 0 < p.Stratum && 0 < ref.Stratum && p.Stratum != ref.Stratum {
+		return p.Stratum < ref.Stratum
+	}
+	return certain && !refCertain
+}
+
+//rank of source. Certain entries without known source are considered as good as NTP (like before metadata)
+func (p SyncMeta) rank(certain bool) int {
+	if p.Source == SYNCSOURCE_UNKNOWN && certain {
+		return syncSourceRank[SYNCSOURCE_NTP]
+	}
+	return syncSourceRank[p.Source]
+}
+
+//NTP stratum telling that time is not synced
+const STRATUM_UNSYNCED = 16
+
+//ServedStratum is NTP stratum when serving time synced from this source to peers (see TimeGopher.ServerTime)
+func (p SyncMeta) ServedStratum() uint8 {
+	switch p.Source {
+	case SYNCSOURCE_GPS:
+		return 1
+	case SYNCSOURCE_NTP, SYNCSOURCE_PEER:
+		if 0 < p.Stratum && p.Stratum < 15 {
+			return p.Stratum + 1
+		}
+		return 3
+	case SYNCSOURCE_CELLULAR, SYNCSOURCE_HTTP:
+		return 4
+	}
+	return 8 //Unknown, manual or hardware RTC
+}
+
+//ToBinary creates binary presentation of sync record
+func (p *SyncRecord) ToBinary() ([]byte, error) {
+	_, errTv := p.TimeVariable.ToBinary(true) //Validity check
+	if errTv != nil {
+		return nil, errTv
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, p.BootNumber)
+	binary.Write(buf, binary.LittleEndian, p.Uptime)
+	binary.Write(buf, binary.LittleEndian, p.Epoch)
+	certain := uint8(0)
+	if p.Certain {
+		certain = 1
+	}
+	buf.Write([]byte{byte(p.Source), p.Stratum, certain, 0})
+	binary.Write(buf, binary.LittleEndian, p.ErrorEstimate)
+	return buf.Bytes(), nil
+}
+
+//ParseSyncRecord parses SyncRecord from binary format
+func ParseSyncRecord(raw []byte) (SyncRecord, error) {
+	if len(raw) != RECORDSIZE_SYNCRECORD {
+		return SyncRecord{}, fmt.Errorf("invalid size %v for sync record", len(raw))
+	}
+	tv, errTv := ParseTimeVariable(raw[0:20], true)
+	if errTv != nil {
+		return SyncRecord{}, errTv
+	}
+	return SyncRecord{
+		TimeVariable: tv,
+		SyncMeta: SyncMeta{
+			Source:        SyncSource(raw[20]),
+			Stratum:       raw[21],
+			ErrorEstimate: NsEpoch(binary.LittleEndian.Uint64(raw[24:32])),
+		},
+		Certain: raw[22] != 0,
+	}, nil
+}
+
+//SyncMetaLog stores SyncRecords. SyncMetaDb is implementation on fixregsto
+type SyncMetaLog interface {
+	Insert(rec SyncRecord) error
+	Find(tv TimeVariable, certain bool) (SyncMeta, bool, error)
+	All() ([]SyncRecord, error)
+}
+
+type SyncMetaDb struct {
+	sto fixregsto.FixRegSto
+	mem []SyncRecord
+}
+
+//CreateSyncMetaDb restores content from FixRegSto storage (RecordSize RECORDSIZE_SYNCRECORD)
+func CreateSyncMetaDb(storage fixregsto.FixRegSto) (SyncMetaDb, error) {
+	raw, readErr := storage.ReadAll()
+	if readErr != nil {
+		return SyncMetaDb{}, fmt.Errorf("error on ReadAll on CreateSyncMetaDb err=%v", readErr.Error())
+	}
+	if len(raw)%RECORDSIZE_SYNCRECORD != 0 {
+		return SyncMetaDb{}, fmt.Errorf("must be multiple of %v (len=%v)", RECORDSIZE_SYNCRECORD, len(raw))
+	}
+	result := SyncMetaDb{sto: storage, mem: make([]SyncRecord, len(raw)/RECORDSIZE_SYNCRECORD)}
+	for i := range result.mem {
+		var errParse error
+		result.mem[i], errParse = ParseSyncRecord(raw[i*RECORDSIZE_SYNCRECORD : (i+1)*RECORDSIZE_SYNCRECORD])
+		if errParse != nil {
+			return result, errParse
+		}
+	}
+	return result, nil
+}
+
+func (p *SyncMetaDb) Insert(rec SyncRecord) error {
+	binarr, errBin := rec.ToBinary()
+	if errBin != nil {
+		return fmt.Errorf("Insert error, binary coding %#v failed %v", rec, errBin)
+	}
+	_, errWrite := p.sto.Write(binarr)
+	if errWrite != nil {
+		return errWrite
+	}
+	p.mem = append(p.mem, rec)
+	return nil
+}
+
+//Find metadata of sync entry, latest first
+func (p *SyncMetaDb) Find(tv TimeVariable, certain bool) (SyncMeta, bool, error) {
+	for i := len(p.mem) - 1; 0 <= i; i-- {
+		if p.mem[i].Certain == certain && p.mem[i].TimeVariable.Equal(tv) {
+			return p.mem[i].SyncMeta, true, nil
+		}
+	}
+	return SyncMeta{}, false, nil
+}
+
+func (p *SyncMetaDb) All() ([]SyncRecord, error) {
+	return p.mem, nil
+}
+
+//insertSync inserts entry to RtcSyncLog (certain) or UncertainRtcSyncLog and its metadata if SyncMetaLog is set
+func (p *TimeGopher) insertSync(tv TimeVariable, certain bool, meta SyncMeta) error {
+	db := p.RtcSyncLog
+	if !certain {
+		db = p.UncertainRtcSyncLog
+	}
+	err := db.Insert(tv)
+	if err != nil {
+		return err
+	}
+	if p.SyncMetaLog == nil {
+		return nil
+	}
+	err = p.SyncMetaLog.Insert(SyncRecord{TimeVariable: tv, SyncMeta: meta, Certain: certain})
+	if err != nil {
+		return fmt.Errorf("inserting sync metadata failed err=%v", err)
+	}
+	return nil
+}
+
+//syncMeta gets metadata of sync entry. Entries without metadata get empty SyncMeta (unknown source)
+func (p *TimeGopher) syncMeta(tv TimeVariable, certain bool) (SyncMeta, error) {
+	if p.SyncMetaLog == nil {
+		return SyncMeta{}, nil
+	}
+	meta, _, err := p.SyncMetaLog.Find(tv, certain)
+	return meta, err
+}
+
+//preferUncertain compares sources of certain and uncertain sync entries
+func (p *TimeGopher) preferUncertain(tvRtc TimeVariable, tvUc TimeVariable) (bool, error) {
+	meta, errMeta := p.syncMeta(tvRtc, true)
+	if errMeta != nil {
+		return false, errMeta
+	}
+	metaUc, errMetaUc := p.syncMeta(tvUc, false)
+	if errMetaUc != nil {
+		return false, errMetaUc
+	}
+	return metaUc.better(false, meta, true), nil
+}
+
+//preferUncertainAt compares sync entries that would be used for solving epoch at boot and uptime
+func (p *TimeGopher) preferUncertainAt(boot int32, uptime NsUptime) (bool, error) {
+	tvRtc, errRtc := solvePointOnLog(p.RtcSyncLog, boot, uptime)
+	if errRtc != nil {
+		return false, errRtc
+	}
+	tvUc, errUc := solvePointOnLog(p.UncertainRtcSyncLog, boot, uptime)
+	if errUc != nil {
+		return false, errUc
+	}
+	return p.preferUncertain(tvRtc, tvUc)
+}
+
+func solvePointOnLog(db TimeLog, boot int32, uptime NsUptime) (TimeVariable, error) {
+	arr, errArr := db.GetOnBoot(boot)
+	if errArr != nil {
+		return TimeVariable{}, errArr
+	}
+	lst := TimeVariableList(arr)
+	return lst.solvePoint(boot, uptime)
+}
@@ -0,0 +1,112 @@
+package timegopher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncRecordBinary(t *testing.T) {
+	rec := SyncRecord{
+		TimeVariable: TimeVariable{BootNumber: 3, Uptime: 1234, Epoch: TESTEPOCH0},
+		SyncMeta:     SyncMeta{Source: SYNCSOURCE_GPS, Stratum: 1, ErrorEstimate: 1000},
+		Certain:      true,
+	}
+	raw, errBin := rec.ToBinary()
+	assert.Equal(t, nil, errBin)
+	assert.Equal(t, RECORDSIZE_SYNCRECORD, len(raw))
+	parsed, errParse := ParseSyncRecord(raw)
+	assert.Equal(t, nil, errParse)
+	assert.Equal(t, rec, parsed)
+
+	assert.Equal(t, SYNCSOURCE_CELLULAR, ParseSyncSource(SYNCSOURCE_CELLULAR.String()))
+	assert.Equal(t, SYNCSOURCE_UNKNOWN, ParseSyncSource("sundial"))
+}
+
+func TestSyncMetaResolve(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_SYNCRECORD, MaxRecords: 16}
+	memsto, errMem := memconf.InitMemLoop()
+	assert.Equal(t, nil, errMem)
+	metaDb, errMeta := CreateSyncMetaDb(&memsto)
+	assert.Equal(t, nil, errMeta)
+
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	dut, errCreate := NewTimeGopher(tNow, true, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+
+	//GPS tells that clock is 500ms behind. Uptime is not affected
+	dut.UptimeCheck = testUptimeChecker(tNow.Add(500*time.Millisecond), 1000)
+	tGps := tNow.Add(10*time.Second + 500*time.Millisecond)
+	assert.Equal(t, nil, dut.DoUncertainTimeSyncWithSource(tGps, SyncMeta{Source: SYNCSOURCE_GPS}))
+	uptimeLater := 1000 + NsUptime(20*time.Second)
+
+	//Without metadata certain sync is used
+	solved, errSolve := dut.SolveTime(1, uptimeLater)
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tNow.Add(20*time.Second), solved)
+
+	dut.SyncMetaLog = &metaDb
+	assert.Equal(t, nil, dut.DoUncertainTimeSyncWithSource(tGps.Add(time.Second), SyncMeta{Source: SYNCSOURCE_GPS}))
+	solved, errSolve = dut.SolveTime(1, uptimeLater)
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tNow.Add(20*time.Second+500*time.Millisecond), solved)
+	dut.UptimeCheck = testUptimeChecker(tNow, 1000)
+
+	//Already synced, new certain entry is added only if source is better
+	assert.Equal(t, nil, dut.RefreshWithSource(tNow.Add(12*time.Second), true, SyncMeta{Source: SYNCSOURCE_MANUAL}))
+	n, _ := rtc.Len()
+	assert.Equal(t, 1, n) //Manual is not better than unknown certain
+
+	assert.Equal(t, nil, dut.RefreshWithSource(tNow.Add(12*time.Second), true, SyncMeta{Source: SYNCSOURCE_GPS, Stratum: 1}))
+	n, _ = rtc.Len()
+	assert.Equal(t, 2, n) //Better source gets new entry even without drift
+	solved, errSolve = dut.SolveTime(1, uptimeLater)
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tNow.Add(20*time.Second), solved) //Same source, certain wins
+
+	restored, errRestore := CreateSyncMetaDb(&memsto)
+	assert.Equal(t, nil, errRestore)
+	all, _ := restored.All()
+	assert.Equal(t, 2, len(all))
+	meta, found, _ := restored.Find(all[1].TimeVariable, true)
+	assert.Equal(t, true, found)
+	assert.Equal(t, SyncMeta{Source: SYNCSOURCE_GPS, Stratum: 1}, meta)
+}
+
+func TestServerTime(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_SYNCRECORD, MaxRecords: 16}
+	memsto, errMem := memconf.InitMemLoop()
+	assert.Equal(t, nil, errMem)
+	metaDb, errMeta := CreateSyncMetaDb(&memsto)
+	assert.Equal(t, nil, errMeta)
+
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Now()
+	conf := TimeGopherConf{TimeNow: tNow, RtcSyncLog: rtc, UncertainRtcSyncLog: uncertain, StartLog: start, StopLog: stop, LastLog: last,
+		UptimeCheck: testUptimeChecker(tNow, 1000), SyncMetaLog: &metaDb}
+	dut, errInit := conf.Init()
+	assert.Equal(t, nil, errInit)
+	_, stratum, synced := dut.ServerTime()
+	assert.Equal(t, false, synced)
+	assert.Equal(t, uint8(STRATUM_UNSYNCED), stratum)
+	ref, errorEstimate := dut.ServerSync()
+	assert.Equal(t, true, ref.IsZero())
+	assert.Equal(t, time.Duration(0), errorEstimate)
+
+	assert.Equal(t, nil, dut.RefreshWithOffset(tNow, time.Hour, SyncMeta{Source: SYNCSOURCE_NTP, Stratum: 2, ErrorEstimate: NsEpoch(5 * time.Millisecond)}))
+	served, stratum, synced := dut.ServerTime()
+	assert.Equal(t, true, synced)
+	assert.Equal(t, uint8(3), stratum)
+	assert.InDelta(t, float64(time.Hour), float64(served.Sub(time.Now())), float64(time.Second))
+	ref, errorEstimate = dut.ServerSync()
+	assert.Equal(t, tNow.Add(time.Hour).UnixNano(), ref.UnixNano())
+	assert.Equal(t, 5*time.Millisecond, errorEstimate)
+
+	//Refresh in sync without new sync entry moves reference time
+	assert.Equal(t, nil, dut.RefreshWithOffset(tNow.Add(time.Minute), time.Hour, SyncMeta{Source: SYNCSOURCE_NTP, Stratum: 2, ErrorEstimate: NsEpoch(5 * time.Millisecond)}))
+	ref, _ = dut.ServerSync()
+	assert.Equal(t, tNow.Add(time.Hour+time.Minute).UnixNano(), ref.UnixNano())
+}
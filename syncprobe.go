@@ -0,0 +1,180 @@
+/*
+Sync state probes
+
+Other ways than adjtimex for resolving inSync parameter. Set SyncProbe on TimeGopher (or TimeGopherConf) and RefreshNow uses it
+*/
+
+package timegopher
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TIMESYNCD_RUNDIR = "/run/systemd/timesync"
+
+type SyncProbe interface {
+	IsSynced() (bool, error)
+}
+
+//AdjtimexProbe uses RtcIsSynced_adjtimex
+type AdjtimexProbe struct{}
+
+func (p *AdjtimexProbe) IsSynced() (bool, error) {
+	return RtcIsSynced_adjtimex()
+}
+
+//TimesyncdProbe checks flag file that systemd-timesyncd creates after first successful sync
+type TimesyncdProbe struct {
+	Fsys fs.FS //Like os.DirFS(TIMESYNCD_RUNDIR)
+}
+
+func CreateTimesyncdProbe() TimesyncdProbe {
+	return TimesyncdProbe{Fsys: os.DirFS(TIMESYNCD_RUNDIR)}
+}
+
+func (p *TimesyncdProbe) IsSynced() (bool, error) {
+	_, err := fs.Stat(p.Fsys, "synchronized")
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+//commandOutput runs command if output function is not given
+func commandOutput(output func() ([]byte, error), name string, args ...string) ([]byte, error) {
+	if output != nil {
+		return output()
+	}
+	return exec.Command(name, args...).Output()
+}
+
+//ParseTimedatectlShow parses key=value lines from "timedatectl show"
+func ParseTimedatectlShow(raw []byte) map[string]string {
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found {
+			result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return result
+}
+
+//TimedatectlProbe runs "timedatectl show" and checks NTPSynchronized
+type TimedatectlProbe struct {
+	Output func() ([]byte, error) //For testing. Default runs timedatectl
+}
+
+func (p *TimedatectlProbe) IsSynced() (bool, error) {
+	raw, err := commandOutput(p.Output, "timedatectl", "show")
+	if err != nil {
+		return false, fmt.Errorf("timedatectl failed err=%v", err)
+	}
+	value, haz := ParseTimedatectlShow(raw)["NTPSynchronized"]
+	if !haz {
+		return false, fmt.Errorf("NTPSynchronized not found from timedatectl output")
+	}
+	return value == "yes", nil
+}
+
+//ChronyTracking is parsed from "chronyc tracking" output
+type ChronyTracking struct {
+	ReferenceId    string
+	Stratum        int
+	LastOffset     time.Duration
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+	LeapStatus     string //Normal, Insert second, Delete second or Not synchronised
+}
+
+//parseChronySeconds parses value like "-0.000023456 seconds"
+func parseChronySeconds(value string) (time.Duration, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty value")
+	}
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+//ParseChronyTracking parses "key : value" lines from "chronyc tracking"
+func ParseChronyTracking(raw []byte) (ChronyTracking, error) {
+	result := ChronyTracking{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	var err error
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Reference ID":
+			result.ReferenceId = value
+		case "Stratum":
+			result.Stratum, err = strconv.Atoi(value)
+		case "Last offset":
+			result.LastOffset, err = parseChronySeconds(value)
+		case "Root delay":
+			result.RootDelay, err = parseChronySeconds(value)
+		case "Root dispersion":
+			result.RootDispersion, err = parseChronySeconds(value)
+		case "Leap status":
+			result.LeapStatus = value
+		}
+		if err != nil {
+			return result, fmt.Errorf("invalid chrony %s err=%v", key, err)
+		}
+	}
+	if len(result.LeapStatus) == 0 {
+		return result, fmt.Errorf("leap status not found from chrony tracking")
+	}
+	return result, nil
+}
+
+//ChronyProbe runs "chronyc tracking". Synced if leap status is not "Not synchronised" and limits are not exceeded
+type ChronyProbe struct {
+	Output            func() ([]byte, error) //For testing. Default runs chronyc
+	MaxRootDispersion time.Duration          //Optional
+	MaxLastOffset     time.Duration          //Optional
+}
+
+func (p *ChronyProbe) IsSynced() (bool, error) {
+	raw, err := commandOutput(p.Output, "chronyc", "tracking")
+	if err != nil {
+		return false, fmt.Errorf("chronyc failed err=%v", err)
+	}
+	tracking, errParse := ParseChronyTracking(raw)
+	if errParse != nil {
+		return false, errParse
+	}
+	if tracking.LeapStatus == "Not synchronised" {
+		return false, nil
+	}
+	if 0 < p.MaxRootDispersion && p.MaxRootDispersion < tracking.RootDispersion {
+		return false, nil
+	}
+	lastOffset := tracking.LastOffset
+	if lastOffset < 0 {
+		lastOffset = -lastOffset
+	}
+	if 0 < p.MaxLastOffset && p.MaxLastOffset < lastOffset {
+		return false, nil
+	}
+	return true, nil
+}
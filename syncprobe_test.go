@@ -0,0 +1,91 @@
+package timegopher
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testChronyTracking = `Reference ID    : C0A80101 (192.168.1.1)
+Stratum         : 3
+Ref time (UTC)  : Wed Jul 20 16:27:07 2022
+System time     : 0.000012345 seconds fast of NTP time
+Last offset     : -0.000023456 seconds
+RMS offset      : 0.000045678 seconds
+Frequency       : 12.345 ppm slow
+Residual freq   : -0.001 ppm
+Skew            : 0.012 ppm
+Root delay      : 0.012345678 seconds
+Root dispersion : 0.000567890 seconds
+Update interval : 64.2 seconds
+Leap status     : Normal
+`
+
+const testTimedatectlShow = `Timezone=Europe/Helsinki
+LocalRTC=no
+CanNTP=yes
+NTP=yes
+NTPSynchronized=yes
+TimeUSec=Wed 2022-07-20 19:27:07 EEST
+RTCTimeUSec=Wed 2022-07-20 16:27:07 EEST
+`
+
+func TestChronyProbe(t *testing.T) {
+	tracking, err := ParseChronyTracking([]byte(testChronyTracking))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ChronyTracking{
+		ReferenceId:    "C0A80101 (192.168.1.1)",
+		Stratum:        3,
+		LastOffset:     -23456 * time.Nanosecond,
+		RootDelay:      12345678 * time.Nanosecond,
+		RootDispersion: 567890 * time.Nanosecond,
+		LeapStatus:     "Normal",
+	}, tracking)
+
+	output := []byte(testChronyTracking)
+	dut := ChronyProbe{Output: func() ([]byte, error) { return output, nil }}
+	synced, errSynced := dut.IsSynced()
+	assert.Equal(t, nil, errSynced)
+	assert.Equal(t, true, synced)
+
+	dut.MaxRootDispersion = 100 * time.Microsecond
+	synced, _ = dut.IsSynced()
+	assert.Equal(t, false, synced)
+
+	dut.MaxRootDispersion = 0
+	output = []byte("Reference ID    : 00000000 ()\nStratum         : 0\nLeap status     : Not synchronised\n")
+	synced, errSynced = dut.IsSynced()
+	assert.Equal(t, nil, errSynced)
+	assert.Equal(t, false, synced)
+
+	output = []byte("506 Cannot talk to daemon\n")
+	_, errSynced = dut.IsSynced()
+	assert.NotEqual(t, nil, errSynced)
+}
+
+func TestTimedatectlProbe(t *testing.T) {
+	output := []byte(testTimedatectlShow)
+	dut := TimedatectlProbe{Output: func() ([]byte, error) { return output, nil }}
+	synced, err := dut.IsSynced()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, synced)
+
+	output = []byte("NTP=no\nNTPSynchronized=no\n")
+	synced, err = dut.IsSynced()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, synced)
+}
+
+func TestTimesyncdProbe(t *testing.T) {
+	dut := TimesyncdProbe{Fsys: fstest.MapFS{"synchronized": &fstest.MapFile{}}}
+	synced, err := dut.IsSynced()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, synced)
+
+	dut.Fsys = fstest.MapFS{"clock": &fstest.MapFile{}}
+	synced, err = dut.IsSynced()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, synced)
+}
@@ -3,7 +3,7 @@
 Struct TimeFileDb is conversion layer for storing TimeVariables to disk in reliable way
 Current implementation persist data on disk but keeps content cached in mem for fast search.
 
-This might be optimized later
+This might be optimized later. BoundedTimeFileDb is alternative that keeps only index and cache in memory
 */
 
 package timegopher
@@ -35,11 +35,9 @@ func (p *TimeFileDb) Insert(t TimeVariable) error { //INSERT only cumulative val
 	if errbin != nil {
 		return fmt.Errorf("Insert error, binary coding %#v failed %v", t, errbin)
 	}
-	n := p.mem.Len()
-	if 0 < n { //If there are points, check that new variable is t is really after. Not before or same
-		if !p.mem[p.mem.Len()-1].Before(t) {
-			return fmt.Errorf("inserted time t=%#v is before latest entry %#v", t, p.mem[p.mem.Len()-1])
-		}
+	errAppend := p.mem.checkAppend(t)
+	if errAppend != nil {
+		return errAppend
 	}
 	_, errWrite := p.sto.Write(binarr)
 	if errWrite != nil {
@@ -95,3 +93,26 @@ func (p *TimeFileDb) SolveBootNumber(epoch NsEpoch) (int32, error) {
 func (p *TimeFileDb) SearchTimeVariable(epoch NsEpoch) (TimeVariable, error) {
 	return p.mem.SearchTimeVariable(epoch)
 }
+
+//CompactTo writes compacted (see TimeVariableList.Compact) content to empty storage and returns TimeFileDb using that storage.
+//Original storage is not modified. Only for TimeFileDb storing RTC.
+func (p *TimeFileDb) CompactTo(target fixregsto.FixRegSto, tolerance NsEpoch) (TimeFileDb, error) {
+	if !p.storeRTC {
+		return TimeFileDb{}, fmt.Errorf("compacting is supported only on TimeFileDb with RTC")
+	}
+	n, errLen := target.Len()
+	if errLen != nil {
+		return TimeFileDb{}, fmt.Errorf("error getting target length on CompactTo err=%v", errLen)
+	}
+	if n != 0 {
+		return TimeFileDb{}, fmt.Errorf("compact target is not empty, have %v records", n)
+	}
+	result := TimeFileDb{sto: target, storeRTC: p.storeRTC, mem: TimeVariableList{}}
+	for _, v := range p.mem.Compact(tolerance) {
+		errInsert := result.Insert(v)
+		if errInsert != nil {
+			return result, fmt.Errorf("error inserting compacted entry %#v err=%v", v, errInsert)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,468 @@
+/*
+Memory bounded TimeFileDb
+
+BoundedTimeFileDb does not keep all entries in memory like TimeFileDb. Only summary per boot is kept in index
+and entries of recently used boots are cached. Other entries are read from FixRegSto storage when needed.
+Boots that do not fit to cache are read by windows: SolveEpoch bisects entries on storage and other queries scan
+boot without keeping it in memory. Queries give same results as TimeFileDb.
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/hjkoskel/fixregsto"
+)
+
+//How many records are read from storage at once while scanning
+const boundedScanChunk = 64
+
+//bootSummary is index entry for one boot
+type bootSummary struct {
+	BootNumber  int32
+	FirstIndex  int //Index of first entry on storage
+	Count       int
+	MinBootTime NsEpoch //Minimum of nonzero epoch-uptime values. For solving boot number
+	HasBootTime bool
+	MinStale    bool //Oldest entries are dropped, MinBootTime can be too small. Solved again when needed
+}
+
+type BoundedTimeFileDb struct {
+	sto          fixregsto.FixRegSto
+	storeRTC     bool
+	index        []bootSummary
+	total        int
+	latest       TimeVariable
+	cacheRecords int //Maximum number of entries in cache
+	cache        map[int32]TimeVariableList
+	cacheOrder   []int32 //Least recently used first
+}
+
+//CreateBoundedTimeFileDb scans FixRegSto storage for creating index. cacheRecords limits how many entries are cached in memory
+func CreateBoundedTimeFileDb(storage fixregsto.FixRegSto, storeRTC bool, cacheRecords int) (BoundedTimeFileDb, error) {
+	result := BoundedTimeFileDb{sto: storage, storeRTC: storeRTC, cacheRecords: cacheRecords}
+	errIndex := result.rebuildIndex()
+	if errIndex != nil {
+		return result, fmt.Errorf("error building index on CreateBoundedTimeFileDb err=%v", errIndex.Error())
+	}
+	return result, nil
+}
+
+func (p *BoundedTimeFileDb) recordSize() int {
+	if p.storeRTC {
+		return RECORDSIZE_TIMEVARIABLE_RTC
+	}
+	return RECORDSIZE_TIMEVARIABLE_NORTC
+}
+
+//seekRecord moves read position to entry at index. Returns index where reading starts.
+//If storage does not seek to record position (like fixregsto.Memloop on large offsets), reading starts from first entry
+func (p *BoundedTimeFileDb) seekRecord(index int) (int, error) {
+	size := int64(p.recordSize())
+	base, errSeek := p.sto.Seek(0, io.SeekStart)
+	if errSeek != nil || index == 0 {
+		return 0, errSeek
+	}
+	pos, errSeek := p.sto.Seek(int64(index)*size, io.SeekStart)
+	if errSeek == nil && pos == base+int64(index)*size {
+		return index, nil
+	}
+	_, errSeek = p.sto.Seek(0, io.SeekStart)
+	return 0, errSeek
+}
+
+//scan reads entries from storage in order, starting from index from. Stops when fn returns false
+func (p *BoundedTimeFileDb) scan(from int, fn func(index int, t TimeVariable) bool) error {
+	index, errSeek := p.seekRecord(from)
+	if errSeek != nil {
+		return errSeek
+	}
+	size := p.recordSize()
+	buf := make([]byte, boundedScanChunk*size)
+	for {
+		n, errRead := p.sto.Read(buf)
+		n -= n % size
+		for pos := 0; pos < n; pos += size {
+			if from <= index {
+				t, errParse := ParseTimeVariable(buf[pos:pos+size], p.storeRTC)
+				if errParse != nil {
+					return fmt.Errorf("error parsing entry %v err=%v", index, errParse)
+				}
+				if !fn(index, t) {
+					return nil
+				}
+			}
+			index++
+		}
+		if errRead == io.EOF || (errRead == nil && n == 0) {
+			return nil
+		}
+		if errRead != nil {
+			return errRead
+		}
+	}
+}
+
+//rebuildIndex scans all entries. Needed at start and if index does not match storage
+func (p *BoundedTimeFileDb) rebuildIndex() error {
+	p.index = []bootSummary{}
+	p.total = 0
+	p.latest = TimeVariable{}
+	p.cache = make(map[int32]TimeVariableList)
+	p.cacheOrder = []int32{}
+	var errOrder error
+	errScan := p.scan(0, func(index int, t TimeVariable) bool {
+		if 0 < index && !p.latest.Before(t) {
+			errOrder = fmt.Errorf("entry %v %#v is not after %#v", index, t, p.latest)
+			return false
+		}
+		p.addToIndex(t)
+		return true
+	})
+	if errScan != nil {
+		return errScan
+	}
+	return errOrder
+}
+
+//dropFromIndex removes count oldest entries from index, after storage have dropped those
+func (p *BoundedTimeFileDb) dropFromIndex(count int) {
+	p.total -= count
+	for i := range p.index {
+		p.index[i].FirstIndex -= count
+	}
+	for 0 < count && 0 < len(p.index) {
+		first := &p.index[0]
+		p.dropCache(first.BootNumber)
+		dropped := min(count, first.Count)
+		first.Count -= dropped
+		count -= dropped
+		if first.Count == 0 {
+			p.index = p.index[1:]
+			continue
+		}
+		first.FirstIndex = 0
+		first.MinStale = first.HasBootTime
+	}
+}
+
+//solveMinBootTime scans entries of boot at index position i for solving MinBootTime again
+func (p *BoundedTimeFileDb) solveMinBootTime(i int) error {
+	summary := &p.index[i]
+	summary.HasBootTime = false
+	errScan := p.scanBoot(*summary, func(t TimeVariable) bool {
+		bootTime := t.Epoch - NsEpoch(t.Uptime)
+		if bootTime != 0 && (!summary.HasBootTime || bootTime < summary.MinBootTime) {
+			summary.MinBootTime = bootTime
+			summary.HasBootTime = true
+		}
+		return true
+	})
+	if errScan != nil {
+		return errScan
+	}
+	summary.MinStale = false
+	return nil
+}
+
+//scanBoot reads entries of boot in order without keeping them in memory. Stops when fn returns false
+func (p *BoundedTimeFileDb) scanBoot(s bootSummary, fn func(t TimeVariable) bool) error {
+	end := s.FirstIndex + s.Count
+	return p.scan(s.FirstIndex, func(index int, t TimeVariable) bool {
+		return index < end && fn(t)
+	})
+}
+
+//readEntry reads one entry at index
+func (p *BoundedTimeFileDb) readEntry(index int) (TimeVariable, error) {
+	start, errSeek := p.seekRecord(index)
+	if errSeek != nil {
+		return TimeVariable{}, errSeek
+	}
+	if start != index { //Storage could not seek, scan from start
+		arr, errRead := p.readRange(index, 1)
+		if errRead != nil {
+			return TimeVariable{}, errRead
+		}
+		if len(arr) == 0 {
+			return TimeVariable{}, fmt.Errorf("entry %v not found, index mismatch", index)
+		}
+		return arr[0], nil
+	}
+	buf := make([]byte, p.recordSize())
+	n, errRead := p.sto.Read(buf)
+	if n < len(buf) {
+		if errRead != nil && errRead != io.EOF {
+			return TimeVariable{}, errRead
+		}
+		return TimeVariable{}, fmt.Errorf("entry %v not found, index mismatch", index)
+	}
+	return ParseTimeVariable(buf, p.storeRTC)
+}
+
+//fitsCache tells is boot small enough for reading it whole to cache. Larger boots are read by windows
+func (p *BoundedTimeFileDb) fitsCache(s bootSummary) bool {
+	_, haz := p.cache[s.BootNumber]
+	return haz || s.Count <= p.cacheRecords
+}
+
+func (p *BoundedTimeFileDb) addToIndex(t TimeVariable) {
+	n := len(p.index)
+	if n == 0 || p.index[n-1].BootNumber != t.BootNumber {
+		p.index = append(p.index, bootSummary{BootNumber: t.BootNumber, FirstIndex: p.total})
+		n++
+	}
+	summary := &p.index[n-1]
+	summary.Count++
+	bootTime := t.Epoch - NsEpoch(t.Uptime)
+	if bootTime != 0 && (!summary.HasBootTime || bootTime < summary.MinBootTime) {
+		summary.MinBootTime = bootTime
+		summary.HasBootTime = true
+	}
+	p.total++
+	p.latest = t
+}
+
+//readRange reads count entries starting from index
+func (p *BoundedTimeFileDb) readRange(from int, count int) (TimeVariableList, error) {
+	result := TimeVariableList{}
+	if count <= 0 {
+		return result, nil
+	}
+	errScan := p.scan(from, func(index int, t TimeVariable) bool {
+		result = append(result, t)
+		return len(result) < count
+	})
+	return result, errScan
+}
+
+//touchCache marks boot as most recently used
+func (p *BoundedTimeFileDb) touchCache(boot int32) {
+	for i, b := range p.cacheOrder {
+		if b == boot {
+			p.cacheOrder = append(p.cacheOrder[:i], p.cacheOrder[i+1:]...)
+			break
+		}
+	}
+	p.cacheOrder = append(p.cacheOrder, boot)
+}
+
+func (p *BoundedTimeFileDb) dropCache(boot int32) {
+	delete(p.cache, boot)
+	for i, b := range p.cacheOrder {
+		if b == boot {
+			p.cacheOrder = append(p.cacheOrder[:i], p.cacheOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+//putCache stores entries of boot and drops least recently used boots if cache is full
+func (p *BoundedTimeFileDb) putCache(boot int32, arr TimeVariableList) {
+	if p.cacheRecords < len(arr) {
+		p.dropCache(boot)
+		return
+	}
+	p.cache[boot] = arr
+	p.touchCache(boot)
+	cached := 0
+	for _, v := range p.cache {
+		cached += len(v)
+	}
+	for p.cacheRecords < cached {
+		oldest := p.cacheOrder[0]
+		cached -= len(p.cache[oldest])
+		delete(p.cache, oldest)
+		p.cacheOrder = p.cacheOrder[1:]
+	}
+}
+
+func (p *BoundedTimeFileDb) summary(boot int32) (bootSummary, bool) {
+	for _, s := range p.index {
+		if s.BootNumber == boot {
+			return s, true
+		}
+	}
+	return bootSummary{}, false
+}
+
+func (p *BoundedTimeFileDb) Insert(t TimeVariable) error {
+	binarr, errbin := t.ToBinary(p.storeRTC)
+	if errbin != nil {
+		return fmt.Errorf("Insert error, binary coding %#v failed %v", t, errbin)
+	}
+	if 0 < p.total && !p.latest.Before(t) {
+		return fmt.Errorf("inserted time t=%#v is before latest entry %#v", t, p.latest)
+	}
+	_, errWrite := p.sto.Write(binarr)
+	if errWrite != nil {
+		return errWrite
+	}
+	if !p.storeRTC {
+		t.Epoch = 0
+	}
+	p.addToIndex(t)
+	cached, haz := p.cache[t.BootNumber]
+	if haz { //Cached slice is returned by GetOnBoot, copy before append
+		p.putCache(t.BootNumber, append(slices.Clip(cached), t))
+	}
+
+	n, errLen := p.sto.Len()
+	if errLen != nil {
+		return errLen
+	}
+	if int(n) < p.total { //Storage dropped oldest entries
+		p.dropFromIndex(p.total - int(n))
+	}
+	if int(n) != p.total {
+		return p.rebuildIndex()
+	}
+	return nil
+}
+
+func (p *BoundedTimeFileDb) GetLatestN(n int) ([]TimeVariable, error) {
+	if n == 1 && 0 < p.total { //Latest is kept on index, called on every refresh
+		return []TimeVariable{p.latest}, nil
+	}
+	if p.total < n {
+		n = p.total
+	}
+	return p.readRange(p.total-n, n)
+}
+
+func (p *BoundedTimeFileDb) GetFirstN(n int) ([]TimeVariable, error) {
+	return p.readRange(0, n)
+}
+
+//GetOnBoot reads all entries of boot. Boots larger than cache are not cached, so memory is not bounded by cache
+func (p *BoundedTimeFileDb) GetOnBoot(boot int32) ([]TimeVariable, error) {
+	cached, haz := p.cache[boot]
+	if haz {
+		p.touchCache(boot)
+		return cached, nil
+	}
+	s, found := p.summary(boot)
+	if !found {
+		return []TimeVariable{}, nil
+	}
+	arr, errRead := p.readRange(s.FirstIndex, s.Count)
+	if errRead != nil {
+		return arr, errRead
+	}
+	if len(arr) != s.Count {
+		return arr, fmt.Errorf("index mismatch on boot %v, got %v entries expected %v", boot, len(arr), s.Count)
+	}
+	p.putCache(boot, arr)
+	return arr, nil
+}
+
+//All reads all entries from storage. Use with caution, memory is not bounded
+func (p *BoundedTimeFileDb) All() ([]TimeVariable, error) {
+	return p.readRange(0, p.total)
+}
+
+func (p *BoundedTimeFileDb) Len() (int, error) {
+	return p.total, nil
+}
+
+//SolveEpoch reads boot to cache if it fits. On larger boots entry is searched by bisect, uptime is increasing on boot
+func (p *BoundedTimeFileDb) SolveEpoch(boot int32, uptime NsUptime) (NsEpoch, error) {
+	if p.total == 0 {
+		return 0, fmt.Errorf("no data in BoundedTimeFileDb, solving bootNumber=%v, uptime=%v", boot, uptime)
+	}
+	s, found := p.summary(boot)
+	if !found {
+		return 0, fmt.Errorf("points not found boot %v", boot)
+	}
+	if p.fitsCache(s) {
+		arr, errArr := p.GetOnBoot(boot)
+		if errArr != nil {
+			return 0, errArr
+		}
+		lst := TimeVariableList(arr)
+		return lst.SolveEpoch(boot, uptime)
+	}
+	lo, hi := 0, s.Count //First entry after uptime
+	for lo < hi {
+		mid := (lo + hi) / 2
+		t, errRead := p.readEntry(s.FirstIndex + mid)
+		if errRead != nil {
+			return 0, errRead
+		}
+		if t.Uptime <= uptime {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	pointIndex := lo - 1
+	if pointIndex < 0 { //Uptime is before first point on boot, use latest on that boot
+		pointIndex = s.Count - 1
+	}
+	point, errPoint := p.readEntry(s.FirstIndex + pointIndex)
+	if errPoint != nil {
+		return 0, errPoint
+	}
+	return point.SolveEpoch(boot, uptime)
+}
+
+func (p *BoundedTimeFileDb) SolveBootNumber(epoch NsEpoch) (int32, error) {
+	if p.total == 0 {
+		return -1, fmt.Errorf("no data, while solving boot number from epoch %v", epoch)
+	}
+	for i := len(p.index) - 1; 0 <= i; i-- {
+		if !p.index[i].HasBootTime || epoch < p.index[i].MinBootTime {
+			continue
+		}
+		if p.index[i].MinStale { //Stale is not larger than actual
+			errSolve := p.solveMinBootTime(i)
+			if errSolve != nil {
+				return -1, errSolve
+			}
+			if !p.index[i].HasBootTime || epoch < p.index[i].MinBootTime {
+				continue
+			}
+		}
+		return p.index[i].BootNumber, nil
+	}
+	return -1, fmt.Errorf("was not able find epoch before %v", epoch)
+}
+
+//SearchTimeVariable reads boot to cache if it fits. Larger boots are scanned without keeping entries in memory
+func (p *BoundedTimeFileDb) SearchTimeVariable(epoch NsEpoch) (TimeVariable, error) {
+	boot, errBoot := p.SolveBootNumber(epoch)
+	if errBoot != nil {
+		return TimeVariable{}, errBoot
+	}
+	s, _ := p.summary(boot)
+	if p.fitsCache(s) {
+		arr, errArr := p.GetOnBoot(boot)
+		if errArr != nil {
+			return TimeVariable{}, errArr
+		}
+		lst := TimeVariableList(arr)
+		return lst.SearchTimeVariable(epoch)
+	}
+	var result TimeVariable
+	var diff NsEpoch
+	n := 0
+	errScan := p.scanBoot(s, func(t TimeVariable) bool {
+		d := t.Epoch.Diff(epoch)
+		if n == 0 || d < diff {
+			result = t
+			diff = d
+		}
+		n++
+		return true
+	})
+	if errScan != nil {
+		return result, errScan
+	}
+	if n != s.Count {
+		return result, fmt.Errorf("index mismatch on boot %v, got %v entries expected %v", boot, n, s.Count)
+	}
+	return result, nil
+}
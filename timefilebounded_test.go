@@ -0,0 +1,232 @@
+package timegopher
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedFilebase(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 100}
+	memRef, _ := memconf.InitMemLoop()
+	memDut, _ := memconf.InitMemLoop()
+	ref, _ := CreateTimeFileDb(&memRef, true)
+	dut, errCreate := CreateBoundedTimeFileDb(&memDut, true, 10)
+	assert.Equal(t, nil, errCreate)
+
+	for boot := int32(1); boot <= 5; boot++ {
+		for i := 1; i <= 7; i++ {
+			tv := TimeVariable{BootNumber: boot, Uptime: NsUptime(i * 1000), Epoch: TESTEPOCH0 + NsEpoch(int(boot)*100000+i*1000+i)}
+			assert.Equal(t, nil, ref.Insert(tv))
+			assert.Equal(t, nil, dut.Insert(tv))
+		}
+	}
+	assert.NotNil(t, dut.Insert(TimeVariable{BootNumber: 2, Uptime: 1000, Epoch: TESTEPOCH0}))
+
+	n, _ := dut.Len()
+	assert.Equal(t, 35, n)
+	refLatest, _ := ref.GetLatestN(3)
+	dutLatest, _ := dut.GetLatestN(3)
+	assert.Equal(t, refLatest, dutLatest)
+	refFirst, _ := ref.GetFirstN(9)
+	dutFirst, _ := dut.GetFirstN(9)
+	assert.Equal(t, refFirst, dutFirst)
+
+	for boot := int32(0); boot <= 6; boot++ {
+		refBoot, _ := ref.GetOnBoot(boot)
+		dutBoot, _ := dut.GetOnBoot(boot)
+		assert.Equal(t, refBoot, dutBoot)
+
+		refEpoch, refErr := ref.SolveEpoch(boot, 3500)
+		dutEpoch, dutErr := dut.SolveEpoch(boot, 3500)
+		assert.Equal(t, refEpoch, dutEpoch)
+		assert.Equal(t, refErr == nil, dutErr == nil)
+	}
+	cached := 0
+	for _, v := range dut.cache {
+		cached += len(v)
+	}
+	assert.LessOrEqual(t, cached, 10)
+
+	for _, epoch := range []NsEpoch{TESTEPOCH0, TESTEPOCH0 + 100000, TESTEPOCH0 + 250000, TESTEPOCH0 + 999999} {
+		refBoot, refErr := ref.SolveBootNumber(epoch)
+		dutBoot, dutErr := dut.SolveBootNumber(epoch)
+		assert.Equal(t, refBoot, dutBoot)
+		assert.Equal(t, refErr == nil, dutErr == nil)
+
+		refTv, _ := ref.SearchTimeVariable(epoch)
+		dutTv, _ := dut.SearchTimeVariable(epoch)
+		assert.Equal(t, refTv, dutTv)
+	}
+
+	restored, errRestore := CreateBoundedTimeFileDb(&memDut, true, 10)
+	assert.Equal(t, nil, errRestore)
+	assert.Equal(t, dut.index, restored.index)
+}
+
+func TestBoundedFilebaseRotate(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_NORTC, MaxRecords: 8}
+	mem, _ := memconf.InitMemLoop()
+	dut, _ := CreateBoundedTimeFileDb(&mem, false, 4)
+	for i := 1; i <= 20; i++ {
+		assert.Equal(t, nil, dut.Insert(TimeVariable{BootNumber: int32(i/3 + 1), Uptime: NsUptime(i * 10)}))
+	}
+	n, _ := dut.Len()
+	assert.Equal(t, 8, n)
+	all, _ := dut.All()
+	assert.Equal(t, TimeVariable{BootNumber: 5, Uptime: 130}, all[0])
+	assert.Equal(t, TimeVariable{BootNumber: 7, Uptime: 200}, all[7])
+}
+
+func TestBoundedFilebaseRotateIndex(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 8}
+	mem, _ := memconf.InitMemLoop()
+	dut, _ := CreateBoundedTimeFileDb(&mem, true, 4)
+	for i := 1; i <= 30; i++ {
+		//Boot time grows inside boot, so minimum is dropped first
+		assert.Equal(t, nil, dut.Insert(TimeVariable{BootNumber: int32(i/7 + 1), Uptime: NsUptime(i * 10), Epoch: NsEpoch(TESTEPOCH0 + i*1000)}))
+
+		rebuilt, errRebuild := CreateBoundedTimeFileDb(&mem, true, 4)
+		assert.Equal(t, nil, errRebuild)
+		assert.Equal(t, rebuilt.total, dut.total)
+		assert.Equal(t, len(rebuilt.index), len(dut.index))
+		for j := range rebuilt.index {
+			assert.Equal(t, rebuilt.index[j].FirstIndex, dut.index[j].FirstIndex)
+			assert.Equal(t, rebuilt.index[j].Count, dut.index[j].Count)
+		}
+
+		all, _ := dut.All()
+		ref := TimeVariableList(all)
+		for epoch := NsEpoch(TESTEPOCH0); epoch < NsEpoch(TESTEPOCH0+31*1000); epoch += 250 {
+			refBoot, refErr := ref.SolveBootNumber(epoch)
+			boot, err := dut.SolveBootNumber(epoch)
+			assert.Equal(t, refBoot, boot, epoch)
+			assert.Equal(t, refErr == nil, err == nil, epoch)
+		}
+	}
+}
+
+func TestBoundedFilebaseCacheCopy(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_NORTC, MaxRecords: 100}
+	mem, _ := memconf.InitMemLoop()
+	dut, _ := CreateBoundedTimeFileDb(&mem, false, 50)
+	for i := 1; i <= 5; i++ {
+		assert.Equal(t, nil, dut.Insert(TimeVariable{BootNumber: 1, Uptime: NsUptime(i)}))
+	}
+	arr, _ := dut.GetOnBoot(1)
+	callerArr := append(arr, TimeVariable{BootNumber: 1, Uptime: 100}) //Caller appends to returned slice
+	assert.Equal(t, nil, dut.Insert(TimeVariable{BootNumber: 1, Uptime: 6}))
+	arr, _ = dut.GetOnBoot(1)
+	assert.Equal(t, TimeVariableList{{BootNumber: 1, Uptime: 1}, {BootNumber: 1, Uptime: 2}, {BootNumber: 1, Uptime: 3}, {BootNumber: 1, Uptime: 4}, {BootNumber: 1, Uptime: 5}, {BootNumber: 1, Uptime: 6}}, TimeVariableList(arr))
+	assert.Equal(t, NsUptime(100), callerArr[5].Uptime)
+}
+
+//testFailingSto fails reads when failRead is set
+type testFailingSto struct {
+	fixregsto.FixRegSto
+	failRead bool
+}
+
+func (p *testFailingSto) Read(arr []byte) (int, error) {
+	if p.failRead {
+		return 0, fmt.Errorf("read failed")
+	}
+	return p.FixRegSto.Read(arr)
+}
+
+func TestBoundedFilebaseIterError(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 100}
+	mem, _ := memconf.InitMemLoop()
+	sto := testFailingSto{FixRegSto: &mem}
+	dut, errCreate := CreateBoundedTimeFileDb(&sto, true, 0)
+	assert.Equal(t, nil, errCreate)
+	for i := 1; i <= 5; i++ {
+		assert.Equal(t, nil, dut.Insert(TimeVariable{BootNumber: int32(i), Uptime: 1000, Epoch: TESTEPOCH0 + NsEpoch(i)}))
+	}
+	arr, errIter := testCollect(dut.Forward())
+	assert.Equal(t, nil, errIter)
+	assert.Equal(t, 5, len(arr))
+
+	sto.failRead = true
+	arr, errIter = testCollect(dut.Forward())
+	assert.NotEqual(t, nil, errIter)
+	assert.Equal(t, 0, len(arr))
+	arr, errIter = testCollect(dut.Backward())
+	assert.NotEqual(t, nil, errIter)
+	assert.Equal(t, 0, len(arr))
+
+	//Error of one iteration is not seen on other
+	sto.failRead = false
+	for _, errOuter := range dut.Forward() {
+		assert.Equal(t, nil, errOuter)
+		arr, errIter = testCollect(dut.Backward())
+		assert.Equal(t, nil, errIter)
+		assert.Equal(t, 5, len(arr))
+		break
+	}
+}
+
+//testCountingSto counts records read from storage
+type testCountingSto struct {
+	fixregsto.FixRegSto
+	recordSize int
+	records    int
+}
+
+func (p *testCountingSto) Read(arr []byte) (int, error) {
+	n, err := p.FixRegSto.Read(arr)
+	p.records += n / p.recordSize
+	return n, err
+}
+
+func TestBoundedFilebaseLargeBoot(t *testing.T) {
+	conf := fixregsto.FileStorageConf{Name: "rtc", RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxFileCount: 3, FileMaxSize: 512 * 4, Path: t.TempDir()}
+	fileSto, errInit := conf.InitFileStorage()
+	assert.Equal(t, nil, errInit)
+	sto := testCountingSto{FixRegSto: &fileSto, recordSize: RECORDSIZE_TIMEVARIABLE_RTC}
+	dut, errCreate := CreateBoundedTimeFileDb(&sto, true, 16)
+	assert.Equal(t, nil, errCreate)
+	for i := 1; i <= 600; i++ { //Oldest files are dropped
+		assert.Equal(t, nil, dut.Insert(TimeVariable{BootNumber: 1, Uptime: NsUptime(i * 1000), Epoch: TESTEPOCH0 + NsEpoch(i*1000+i%7)}))
+	}
+	all, errAll := dut.All()
+	assert.Equal(t, nil, errAll)
+	ref := TimeVariableList(all)
+	assert.Less(t, len(ref), 600)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 600000, Epoch: TESTEPOCH0 + 600000 + 5}, ref[len(ref)-1])
+
+	sto.records = 0
+	latest, _ := dut.GetLatestN(1)
+	assert.Equal(t, ref[len(ref)-1:], TimeVariableList(latest))
+	assert.Equal(t, 0, sto.records)
+
+	for _, uptime := range []NsUptime{10, 250500, 350000, 599999, 999999} {
+		sto.records = 0
+		refEpoch, refErr := ref.SolveEpoch(1, uptime)
+		dutEpoch, dutErr := dut.SolveEpoch(1, uptime)
+		assert.Equal(t, refErr, dutErr)
+		assert.Equal(t, refEpoch, dutEpoch)
+		assert.LessOrEqual(t, sto.records, 12) //Bisect
+	}
+	for _, epoch := range []NsEpoch{TESTEPOCH0 + 250500, TESTEPOCH0 + 400003, TESTEPOCH0 + 999999} {
+		refTv, refErr := ref.SearchTimeVariable(epoch)
+		dutTv, dutErr := dut.SearchTimeVariable(epoch)
+		assert.Equal(t, refErr, dutErr)
+		assert.Equal(t, refTv, dutTv)
+	}
+	assert.Equal(t, 0, len(dut.cache))
+
+	sto.records = 0
+	arr, errRange := dut.Range(TimeVariable{BootNumber: 1, Uptime: 400000}, TimeVariable{BootNumber: 1, Uptime: 410000})
+	assert.Equal(t, nil, errRange)
+	assert.Equal(t, []TimeVariable(ref.Range(TimeVariable{BootNumber: 1, Uptime: 400000}, TimeVariable{BootNumber: 1, Uptime: 410000})), arr)
+	assert.LessOrEqual(t, sto.records, 12+boundedScanChunk) //Bisect and one window
+
+	backward, errBackward := testCollect(dut.Backward())
+	assert.Equal(t, nil, errBackward)
+	slices.Reverse(backward)
+	assert.Equal(t, []TimeVariable(ref), backward)
+}
@@ -20,39 +20,46 @@ import (
 type TimeGopher struct {
 	synced bool //Is good RTC known.
 
+	offset time.Duration //Correction from system clock to wall clock when synced by RefreshWithOffset
+
 	RtcMaxDeviation NsEpoch //deviation in nanosecond from RTC when in sync. Set variable default value if need to change settings
 
-	UncertainRtcSyncLog *TimeFileDb //For manual sync
-	RtcSyncLog          *TimeFileDb
-	StartLog            *TimeFileDb //boot number and uptime
-	StopLog             *TimeFileDb //boot number and uptime needed
-	LastLog             *TimeFileDb //Last alive situation
+	UncertainRtcSyncLog TimeLog //For manual sync
+	RtcSyncLog          TimeLog
+	StartLog            TimeLog //boot number and uptime
+	StopLog             TimeLog //boot number and uptime needed
+	LastLog             TimeLog //Last alive situation
+	CleanStopLog        TimeLog //Optional. Written by Stop. Run without entry here has crashed
+
+	SyncMetaLog SyncMetaLog //Optional. Source and quality of sync entries, used for choosing between sync entries
+	SyncProbe   SyncProbe   //Optional. Used by RefreshNow, adjtimex is used if not set
+
+	ClockEventLog ClockEventLog //Optional. Clock steps
+	JumpLog       ClockEventLog //Optional. Wall clock jumps detected on refresh
+	JumpThreshold NsEpoch       //Smallest recorded jump. Slew rate allowance is added (see detectJump)
+
+	OnCorrection func(corrections []EpochCorrection) //Optional. Called when certain sync contradicts uncertain syncs made after previous certain sync of boot
 
 	coldStart bool //VolatileAlive     *TimeFileDb //Detects is there resets,
 
 	//Last item on start log BootNumber int32
 	bootNumber int32
 
+	jumpRef TimeVariable //System clock epoch and uptime on previous refresh
+
+	syncedAt NsEpoch //Epoch of latest refresh in sync. Reference time served to peers
+
+	bootVote BootVoteResult //Boot counter voting at init
+
 	UptimeCheck *UptimeChecker //Create externally, better for testing
 }
 
-//GetLatestTime picks the last entry of any TimeFileDb entry inside TimeGopher instance. Used internally and for diagnostics
+//GetLatestTime picks the last entry of any TimeLog entry inside TimeGopher instance. Used internally and for diagnostics
 func (p *TimeGopher) GetLatestTime() (TimeVariable, error) {
 	result := TimeVariable{BootNumber: 0}
 
-	dbArr := []*TimeFileDb{
-		p.RtcSyncLog,
-		p.StartLog,
-		p.StopLog,
-		p.LastLog,
-		p.UncertainRtcSyncLog,
-	}
-
-	for _, db := range dbArr {
-		if db == nil {
-			continue
-		}
-		arr, errArr := (*db).GetLatestN(1)
+	for _, db := range p.logs() {
+		arr, errArr := db.GetLatestN(1)
 		if errArr != nil {
 			return result, errArr
 		}
@@ -70,6 +77,60 @@ func (p *TimeGopher) GetLatestTime() (TimeVariable, error) {
 	return result, nil
 }
 
+//logs lists all TimeLogs that are set
+func (p *TimeGopher) logs() []TimeLog {
+	result := []TimeLog{}
+	for _, db := range []TimeLog{p.RtcSyncLog, p.StartLog, p.StopLog, p.LastLog, p.UncertainRtcSyncLog} {
+		if !isNilLog(db) {
+			result = append(result, db)
+		}
+	}
+	return result
+}
+
+//Names of logs for diagnostics
+const (
+	LOGNAME_RTC          = "rtc"
+	LOGNAME_UNCERTAINRTC = "uncertain"
+	LOGNAME_START        = "start"
+	LOGNAME_STOP         = "stop"
+	LOGNAME_ALIVE        = "alive"
+)
+
+var LOGNAMES = []string{LOGNAME_RTC, LOGNAME_UNCERTAINRTC, LOGNAME_START, LOGNAME_STOP, LOGNAME_ALIVE}
+
+//NamedLogs gives logs that are set by name (LOGNAME_...)
+func (p *TimeGopher) NamedLogs() map[string]TimeLog {
+	result := make(map[string]TimeLog)
+	for name, db := range map[string]TimeLog{
+		LOGNAME_RTC:          p.RtcSyncLog,
+		LOGNAME_UNCERTAINRTC: p.UncertainRtcSyncLog,
+		LOGNAME_START:        p.StartLog,
+		LOGNAME_STOP:         p.StopLog,
+		LOGNAME_ALIVE:        p.LastLog,
+	} {
+		if !isNilLog(db) {
+			result[name] = db
+		}
+	}
+	return result
+}
+
+//syncLogs persists logs that implement TimeLogSyncer. Called once after each operation that inserts entries
+func (p *TimeGopher) syncLogs() error {
+	for _, db := range p.logs() {
+		syncer, isSyncer := db.(TimeLogSyncer)
+		if !isSyncer {
+			continue
+		}
+		errSync := syncer.Sync()
+		if errSync != nil {
+			return fmt.Errorf("log sync failed err=%v", errSync)
+		}
+	}
+	return nil
+}
+
 //FirstStartAfterBoot, helper function. Call and tell is this the first time. Creates file.
 func FirstCallAfterBoot(flagfilename string) (bool, error) {
 	info, err := os.Stat(flagfilename)
@@ -85,16 +146,18 @@ func FirstCallAfterBoot(flagfilename string) (bool, error) {
 
 //NewTimeGopher initializes TimeGopher
 //Call only once per software run. If this is too complicated and customization is needed then call CreateDefaultTimeGopher( instead.
+//Optional features (like HwClock) are available by using TimeGopherConf directly
+//Nil pointer as log (like (*TimeFileDb)(nil)) is same as nil, optional log is not used and missing rtcSyncLog is error
 
 //Parameters:
 //	timeNow, give time.Now() as parameter
 //	inSync, set true if system time is synchronized when TimeGopher is created. Resolve for example with RtcIsSynced_adjtimex()
 //	coldStart, set true if first start. Resolve this for example with FirstCallAfterBoot(WARMSTARTFILE)
-//	rtcSyncLog, TimeFileDb pointer for storing certain sync events
-//	uncertainRtcSyncLog, TimeFileDb pointer for storing uncertain sync events. Nil if not needed
-//	startLog TimeFileDb, TimeFileDb pointer for storing entries when software starts (colds and warms). Nil if not needed
-//	stopLog TimeFileDb, TimeFileDb pointer for storing entries when software stops (entries added at next TimeGopher init). Nil if not needed
-//	lastLog TimeFileDb, TimeFileDb pointer for keeping up situation status when sofware was running
+//	rtcSyncLog, TimeLog (like *TimeFileDb) for storing certain sync events
+//	uncertainRtcSyncLog, TimeLog for storing uncertain sync events. Nil if not needed
+//	startLog TimeLog, TimeLog for storing entries when software starts (colds and warms). Nil if not needed
+//	stopLog TimeLog, TimeLog for storing entries when software stops (entries added at next TimeGopher init). Nil if not needed
+//	lastLog TimeLog, TimeLog for keeping up situation status when sofware was running
 //	latestKnowTimeElsewhere TimeVariable, //If some other time stamp information is kept outside TimeGopher, get latest entry here
 //	uptimeCheck, Pointer for uptime checker. There can be many implementations depeding on needs. (or unit test requires dummy version)
 func NewTimeGopher(
@@ -103,34 +166,99 @@ func NewTimeGopher(
 	inSync bool,
 	coldStart bool,
 	//These have RTC time
-	rtcSyncLog *TimeFileDb,
-	uncertainRtcSyncLog *TimeFileDb, //Optional
+	rtcSyncLog TimeLog,
+	uncertainRtcSyncLog TimeLog, //Optional
 
-	startLog *TimeFileDb, //Optional
-	stopLog *TimeFileDb, //Optional
+	startLog TimeLog, //Optional
+	stopLog TimeLog, //Optional
 
-	lastLog *TimeFileDb, //Last alive situation
+	lastLog TimeLog, //Last alive situation
 
 	latestKnowTimeElsewhere TimeVariable, //If knows from latest stored timestamp on timeseries database
 	uptimeCheck *UptimeChecker,
 ) (TimeGopher, error) {
+	conf := TimeGopherConf{
+		TimeNow:                 timeNow,
+		InSync:                  inSync,
+		ColdStart:               coldStart,
+		RtcSyncLog:              rtcSyncLog,
+		UncertainRtcSyncLog:     uncertainRtcSyncLog,
+		StartLog:                startLog,
+		StopLog:                 stopLog,
+		LastLog:                 lastLog,
+		LatestKnowTimeElsewhere: latestKnowTimeElsewhere,
+		UptimeCheck:             uptimeCheck,
+	}
+	return conf.Init()
+}
+
+//TimeGopherConf have same parameters as NewTimeGopher and optional features. Call Init once per software run
+type TimeGopherConf struct {
+	TimeNow   time.Time
+	InSync    bool
+	ColdStart bool
+
+	RtcSyncLog          TimeLog
+	UncertainRtcSyncLog TimeLog //Optional
+	StartLog            TimeLog //Optional
+	StopLog             TimeLog //Optional
+	LastLog             TimeLog
+	CleanStopLog        TimeLog //Optional
+
+	LatestKnowTimeElsewhere TimeVariable
+	UptimeCheck             *UptimeChecker
+
+	SyncMetaLog SyncMetaLog //Optional
+	HwClock     HwClock     //Optional. Initial uncertain sync is read from hardware RTC instead of using TimeNow as guess
+	SyncProbe   SyncProbe   //Optional. Used by RefreshNow
 
+	ClockEventLog ClockEventLog //Optional
+	JumpLog       ClockEventLog //Optional
+
+	BootCounters []BootCounterStore //Optional. Redundant copies of boot counter, voted with boot number from logs
+
+	OnCorrection func(corrections []EpochCorrection) //Optional
+}
+
+//newTimeGopher creates TimeGopher with logs and optional features of conf and default settings. Shared by Init and Snapshot.Restore
+func (p *TimeGopherConf) newTimeGopher() (TimeGopher, error) {
 	result := TimeGopher{
-		synced:              inSync,
-		RtcMaxDeviation:     5 * 1000 * 1000 * 1000, //TODO ADD AS PARAMETER. Or change default separately
-		UncertainRtcSyncLog: uncertainRtcSyncLog,
-		RtcSyncLog:          rtcSyncLog,
-		StartLog:            startLog,
-		StopLog:             stopLog,
-		LastLog:             lastLog,
+		RtcMaxDeviation:     5 * 1000 * 1000 * 1000,             //TODO ADD AS PARAMETER. Or change default separately
+		UncertainRtcSyncLog: optionalLog(p.UncertainRtcSyncLog), //Typed nil like (*TimeFileDb)(nil) is same as not set
+		RtcSyncLog:          optionalLog(p.RtcSyncLog),
+		StartLog:            optionalLog(p.StartLog),
+		StopLog:             optionalLog(p.StopLog),
+		LastLog:             optionalLog(p.LastLog),
+		CleanStopLog:        optionalLog(p.CleanStopLog),
 
-		coldStart:   coldStart,
-		UptimeCheck: uptimeCheck,
-	}
+		SyncMetaLog: p.SyncMetaLog,
+		SyncProbe:   p.SyncProbe,
+
+		ClockEventLog: p.ClockEventLog,
+		JumpLog:       p.JumpLog,
+		JumpThreshold: JUMPDETECT_DEFAULTTHRESHOLD,
 
+		OnCorrection: p.OnCorrection,
+
+		UptimeCheck: p.UptimeCheck,
+	}
 	if result.RtcSyncLog == nil {
 		return result, fmt.Errorf("RtcSyncLog required")
 	}
+	return result, nil
+}
+
+//Init initializes TimeGopher
+func (p *TimeGopherConf) Init() (TimeGopher, error) {
+	timeNow := p.TimeNow
+	latestKnowTimeElsewhere := p.LatestKnowTimeElsewhere
+
+	result, errNew := p.newTimeGopher()
+	if errNew != nil {
+		return result, errNew
+	}
+	result.synced = p.InSync
+	result.coldStart = p.ColdStart
 
 	latestTime, errBoot := result.GetLatestTime()
 	if errBoot != nil {
@@ -139,19 +267,32 @@ func NewTimeGopher(
 	if latestKnowTimeElsewhere.After(latestTime) {
 		latestTime = latestKnowTimeElsewhere
 	}
-	//Record latest to stoplog IF needed
+	//Record latest to stoplog IF needed. Stop have already recorded it if previous run was stopped
 	if result.StopLog != nil && 0 < latestTime.Uptime {
-		errInsertStop := (*result.StopLog).Insert(latestTime)
-		if errInsertStop != nil {
-			return result, fmt.Errorf("NewTimeGopher failed inserting %#v", errInsertStop.Error())
+		stopped, errStopped := result.StopLog.GetLatestN(1)
+		if errStopped != nil {
+			return result, fmt.Errorf("NewTimeGopher failed reading stop log err=%v", errStopped)
+		}
+		if len(stopped) == 0 || stopped[0].BootNumber != latestTime.BootNumber || stopped[0].Uptime != latestTime.Uptime {
+			errInsertStop := result.StopLog.Insert(latestTime)
+			if errInsertStop != nil {
+				return result, fmt.Errorf("NewTimeGopher failed inserting %#v", errInsertStop.Error())
+			}
 		}
 	}
 
 	//Determine bootNumber. Cold boot means increase in boot counter
 	result.bootNumber = latestTime.BootNumber
+	if 0 < len(p.BootCounters) {
+		result.bootVote = VoteBootNumber(latestTime.BootNumber, p.BootCounters)
+		result.bootNumber = result.bootVote.Boot
+	}
 	if result.coldStart {
 		result.bootNumber++
 	}
+	if 0 < len(p.BootCounters) {
+		result.writeBootCounters(p.BootCounters)
+	}
 
 	//Insert RTC sync if synced but log does not have sync entry
 
@@ -162,19 +303,27 @@ func NewTimeGopher(
 		if errTNow != nil {
 			return result, fmt.Errorf("converting timeNow=%v to TimeVariable fail %v", timeNow, errTNow)
 		}
+		meta := SyncMeta{}
+		if p.HwClock != nil {
+			hwEpoch, errHw := result.readHwClock(p.HwClock, latestKnowTimeElsewhere)
+			if errHw == nil { //Hardware RTC is better guess. If not available use bad guess
+				tNow.Epoch = hwEpoch
+				meta = SyncMeta{Source: SYNCSOURCE_RTC, ErrorEstimate: HWRTC_ERRORESTIMATE}
+			}
+		}
 
 		if result.coldStart {
-			insertErr := (*result.UncertainRtcSyncLog).Insert(tNow) //At least one
+			insertErr := result.insertSync(tNow, false, meta) //At least one
 			if insertErr != nil {
 				return result, fmt.Errorf("error inserting uncertainRTCSyncLog at init err=%v", insertErr)
 			}
 		} else {
-			n, errN := (*result.UncertainRtcSyncLog).Len()
+			n, errN := result.UncertainRtcSyncLog.Len()
 			if errN != nil {
 				return result, fmt.Errorf("UncertainRtcSyncLog len err %v", errN)
 			}
 			if n == 0 { //In theory could not happen if warm start. Except if file is lost?
-				insertErr := (*result.UncertainRtcSyncLog).Insert(tNow) //At least one
+				insertErr := result.insertSync(tNow, false, meta) //At least one
 				if insertErr != nil {
 					return result, fmt.Errorf("error inserting UncertainRtcSyncLog %v", insertErr.Error())
 				}
@@ -188,9 +337,14 @@ func NewTimeGopher(
 		return result, fmt.Errorf("UptimeCheck fail %v", errUt.Error())
 	}
 
+	errJumpRef := result.initJumpRef(timeNow, NsUptime(ut))
+	if errJumpRef != nil {
+		return result, fmt.Errorf("error reading jump reference err=%v", errJumpRef)
+	}
+
 	//Recod startLog
 	if result.StartLog != nil {
-		errStartInsert := (*result.StartLog).Insert(TimeVariable{BootNumber: result.bootNumber, Uptime: NsUptime(ut)})
+		errStartInsert := result.StartLog.Insert(TimeVariable{BootNumber: result.bootNumber, Uptime: NsUptime(ut)})
 		if errStartInsert != nil {
 			return result, fmt.Errorf("error inserting start %v", errStartInsert.Error())
 		}
@@ -217,6 +371,11 @@ func (p *TimeGopher) DoUncertainTimeSyncNow() error {
 //UncertainTimeSync called by library user, after realtime clock is set from unreliable source like set manually
 //This function adds time to uncertain RTC sync log. Uncertain sync is used if certain sync is not available
 func (p *TimeGopher) DoUncertainTimeSync(t time.Time) error {
+	return p.DoUncertainTimeSyncWithSource(t, SyncMeta{})
+}
+
+//DoUncertainTimeSyncWithSource is DoUncertainTimeSync with information where time came from. Meta is stored if SyncMetaLog is set
+func (p *TimeGopher) DoUncertainTimeSyncWithSource(t time.Time, meta SyncMeta) error {
 	if p.UncertainRtcSyncLog == nil {
 		return fmt.Errorf("uncertain RTC sync log is not set")
 	}
@@ -226,16 +385,20 @@ func (p *TimeGopher) DoUncertainTimeSync(t time.Time) error {
 		return tNowErr
 	}
 	tNow.Epoch = NsEpoch(t.UnixNano()) //Insert bad guess, better than nothing
-	err := (*p.UncertainRtcSyncLog).Insert(tNow)
+	err := p.insertSync(tNow, false, meta)
 	if err != nil {
 		return err
 	}
-	return nil
+	return p.syncLogs()
 }
 
-//RefreshNow is helper function for Refresh
+//RefreshNow is helper function for Refresh. Sync status is checked with SyncProbe or with adjtimex
 func (p *TimeGopher) RefreshNow() error {
-	inSync, errInSync := RtcIsSynced_adjtimex()
+	var probe SyncProbe = &AdjtimexProbe{}
+	if p.SyncProbe != nil {
+		probe = p.SyncProbe
+	}
+	inSync, errInSync := probe.IsSynced()
 	if errInSync != nil {
 		return fmt.Errorf("RefreshNow checking rtc sync error= %v", errInSync)
 	}
@@ -243,14 +406,91 @@ func (p *TimeGopher) RefreshNow() error {
 }
 
 //Refresh function is called as often as application requires.
-//Calling frequently creates frequent synclog entries so determining when sofware was running
+//Calling frequently creates frequent synclog entries so determining when sofware was running.
+//System clock is the reference, offset set by RefreshWithOffset is reset to 0
 func (p *TimeGopher) Refresh(t time.Time, inSync bool) error {
+	return p.RefreshWithSource(t, inSync, SyncMeta{})
+}
+
+//RefreshWithSource is Refresh with information where synced time came from. Meta is stored if SyncMetaLog is set.
+//Sync entry is also added if source is better than source of latest sync entry. Resets offset like Refresh
+func (p *TimeGopher) RefreshWithSource(t time.Time, inSync bool, meta SyncMeta) error {
+	p.offset = 0 //System clock is the reference
+	return p.refresh(t, inSync, meta)
+}
+
+//RefreshWithOffset is called when offset of system clock is measured (like from NTP) but system clock is not set.
+//Wall clock is system clock + offset on sync entries and conversions until Refresh or RefreshWithSource is called
+func (p *TimeGopher) RefreshWithOffset(t time.Time, offset time.Duration, meta SyncMeta) error {
+	p.offset = offset
+	return p.refresh(t, true, meta)
+}
+
+//ClockOffset is correction from system clock to wall clock (set by RefreshWithOffset)
+func (p *TimeGopher) ClockOffset() time.Duration {
+	return p.offset
+}
+
+//ServerTime is time for serving to peers (like timesync.NtpResponder): system clock + offset, stratum from latest certain sync source and sync status
+func (p *TimeGopher) ServerTime() (time.Time, uint8, bool) {
+	t := time.Now().Add(p.offset)
+	meta, synced := p.servedMeta()
+	if !synced {
+		return t, STRATUM_UNSYNCED, false
+	}
+	return t, meta.ServedStratum(), true
+}
+
+//ServerSync is reference time (latest refresh in sync) and error estimate of latest certain sync for serving to peers (timesync.ServerSyncInfo). Zero if not synced
+func (p *TimeGopher) ServerSync() (time.Time, time.Duration) {
+	tv, meta, synced := p.latestServedSync()
+	if !synced {
+		return time.Time{}, 0
+	}
+	ref := tv.Epoch
+	if ref < p.syncedAt {
+		ref = p.syncedAt
+	}
+	return time.Unix(0, int64(ref)), time.Duration(meta.ErrorEstimate)
+}
+
+//servedMeta is metadata of latest certain sync. False if not synced
+func (p *TimeGopher) servedMeta() (SyncMeta, bool) {
+	_, meta, synced := p.latestServedSync()
+	return meta, synced
+}
+
+//latestServedSync is latest certain sync entry and its metadata. False if not synced
+func (p *TimeGopher) latestServedSync() (TimeVariable, SyncMeta, bool) {
+	if !p.synced {
+		return TimeVariable{}, SyncMeta{}, false
+	}
+	arr, errArr := p.RtcSyncLog.GetLatestN(1)
+	if errArr != nil || len(arr) == 0 {
+		return TimeVariable{}, SyncMeta{}, false
+	}
+	meta, errMeta := p.syncMeta(arr[0], true)
+	if errMeta != nil {
+		return TimeVariable{}, SyncMeta{}, false
+	}
+	if meta.Source == SYNCSOURCE_UNKNOWN {
+		meta.Source = SYNCSOURCE_NTP //Synced by system, like ntpd
+	}
+	return arr[0], meta, true
+}
+
+func (p *TimeGopher) refresh(t time.Time, inSync bool, meta SyncMeta) error {
 	tNow, errTNow := p.Convert(t)
 	if errTNow != nil {
 		return fmt.Errorf("Convert error %v at Refresh", errTNow.Error())
 	}
 
-	tNow.Epoch = NsEpoch(t.UnixNano()) //Needed because convert time might set epoch if epoch sync was not found
+	errJump := p.detectJump(TimeVariable{BootNumber: tNow.BootNumber, Uptime: tNow.Uptime, Epoch: NsEpoch(t.UnixNano())})
+	if errJump != nil {
+		return errJump
+	}
+
+	tNow.Epoch = NsEpoch(t.Add(p.offset).UnixNano()) //Needed because convert time might set epoch if epoch sync was not found
 
 	if inSync {
 		if p.synced { //In sync and still says that it is. Can drift thou
@@ -271,16 +511,25 @@ func (p *TimeGopher) Refresh(t time.Time, inSync bool) error {
 				if p.RtcMaxDeviation < drift {
 					needFresh = true
 				}
+				if p.SyncMetaLog != nil {
+					latestMeta, errMeta := p.syncMeta(arrLatest[0], true)
+					if errMeta != nil {
+						return errMeta
+					}
+					if meta.better(true, latestMeta, true) {
+						needFresh = true
+					}
+				}
 			}
 
 			if needFresh {
-				err := (*p.RtcSyncLog).Insert(tNow)
+				err := p.insertCertainSync(tNow, meta)
 				if err != nil {
 					return err
 				}
 			}
 		} else { //State changed to sync
-			err := (*p.RtcSyncLog).Insert(tNow)
+			err := p.insertCertainSync(tNow, meta)
 			if err != nil {
 				return err
 			}
@@ -288,13 +537,43 @@ func (p *TimeGopher) Refresh(t time.Time, inSync bool) error {
 	}
 
 	p.synced = inSync
+	if inSync {
+		p.syncedAt = tNow.Epoch
+	}
 
 	if p.LastLog != nil {
-		err := (*p.LastLog).Insert(tNow)
+		err := p.LastLog.Insert(tNow)
 		if err != nil {
 			return fmt.Errorf("inserting %#v failed with err=%#v", tNow, err)
 		}
 	}
+	return p.syncLogs()
+}
+
+//Stop records clean stop of software to StopLog and CleanStopLog. Call when software is shut down on purpose.
+//Next Init detects crash (see DetectedCrashes) if run ends without Stop
+func (p *TimeGopher) Stop(t time.Time) error {
+	ut, errUt := p.UptimeCheck.UptimeNano(t)
+	if errUt != nil {
+		return fmt.Errorf("UptimeCheck fail %v", errUt.Error())
+	}
+	tStop := TimeVariable{BootNumber: p.bootNumber, Uptime: NsUptime(ut)}
+	for _, db := range []TimeLog{p.StopLog, p.CleanStopLog} {
+		if db == nil {
+			continue
+		}
+		err := db.Insert(tStop)
+		if err != nil {
+			return fmt.Errorf("inserting stop %#v failed with err=%v", tStop, err)
+		}
+		syncer, isSyncer := db.(TimeLogSyncer)
+		if isSyncer {
+			errSync := syncer.Sync()
+			if errSync != nil {
+				return fmt.Errorf("log sync failed err=%v", errSync)
+			}
+		}
+	}
 	return nil
 }
 
@@ -303,7 +582,8 @@ func (p *TimeGopher) Unconvert(tv TimeVariable) (time.Time, error) {
 	return p.SolveTime(tv.BootNumber, tv.Uptime)
 }
 
-//Convert time at current boot to TimeVariable
+//Convert time at current boot to TimeVariable. Time of current boot is system clock and offset is added to epoch.
+//Time before current boot must be wall clock time
 func (p *TimeGopher) Convert(t time.Time) (TimeVariable, error) {
 	ut, utCheckErr := p.UptimeCheck.UptimeNano(t)
 	if utCheckErr != nil {
@@ -316,11 +596,11 @@ func (p *TimeGopher) Convert(t time.Time) (TimeVariable, error) {
 			Uptime:     NsUptime(ut),
 		}
 		if p.synced {
-			result.Epoch = NsEpoch(t.UnixNano())
+			result.Epoch = NsEpoch(t.Add(p.offset).UnixNano())
 		}
 		return result, nil
 	}
-	//Have to search on what boot this might happend. Variable t must have synced wall clock time
+	//Have to search on what boot this might happend. Variable t must have synced wall clock time, offset is not added
 	result := TimeVariable{Epoch: NsEpoch(t.UnixNano())}
 	if result.Epoch < EPOCH70S {
 		return result, fmt.Errorf("Convert:Missing epoch, 1970's not supported")
@@ -362,6 +642,16 @@ func (p *TimeGopher) Convert(t time.Time) (TimeVariable, error) {
 		return result, nil
 	}
 	//Both
+	if tvUcRtc.BootNumber == tvRtc.BootNumber && p.SyncMetaLog != nil {
+		preferUc, errPrefer := p.preferUncertain(tvRtc, tvUcRtc)
+		if errPrefer != nil {
+			return result, errPrefer
+		}
+		if preferUc {
+			result.Uptime = utUcResult
+			return result, nil
+		}
+	}
 	if tvUcRtc.BootNumber <= tvRtc.BootNumber {
 		result.Uptime = utResult
 		return result, nil
@@ -379,6 +669,15 @@ func (p *TimeGopher) SolveTime(boot int32, uptime NsUptime) (time.Time, error) {
 	if p.UncertainRtcSyncLog != nil {
 		epochUc, epochUcErr = p.UncertainRtcSyncLog.SolveEpoch(boot, uptime)
 	}
+	if epochErr == nil && epochUcErr == nil && p.SyncMetaLog != nil {
+		preferUc, errPrefer := p.preferUncertainAt(boot, uptime)
+		if errPrefer != nil {
+			return time.Unix(0, 0), errPrefer
+		}
+		if preferUc {
+			return time.Unix(0, int64(epochUc)), nil
+		}
+	}
 	if epochErr == nil {
 		return time.Unix(0, int64(epoch)), nil
 	}
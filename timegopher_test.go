@@ -4,8 +4,11 @@ timegopher_test.go
 package timegopher
 
 import (
+	"maps"
 	"os"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -23,8 +26,56 @@ func TestColdBoot(t *testing.T) {
 
 }
 
-//TODO TEST time organizer function per test.. initialize what needed
+//testMemLogs creates in-memory logs for TimeGopher: rtc, uncertain, start, stop and last
+func testMemLogs() (*TimeMemDb, *TimeMemDb, *TimeMemDb, *TimeMemDb, *TimeMemDb) {
+	rtc := CreateTimeMemDb(true)
+	uncertain := CreateTimeMemDb(true)
+	start := CreateTimeMemDb(false)
+	stop := CreateTimeMemDb(false)
+	last := CreateTimeMemDb(false)
+	return &rtc, &uncertain, &start, &stop, &last
+}
+
+//testUptimeChecker creates uptime checker where tNow is at uptime
+func testUptimeChecker(tNow time.Time, uptime NsUptime) *UptimeChecker {
+	return &UptimeChecker{createdUptime: uptime, createdTime: tNow}
+}
+
+func TestTypedNilLogs(t *testing.T) {
+	rtc, _, _, _, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	var uncertain, start, stop *TimeFileDb
+	g, errCreate := NewTimeGopher(tNow, true, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+	assert.Equal(t, nil, g.StopLog)
+	assert.Equal(t, []string{LOGNAME_ALIVE, LOGNAME_RTC}, slices.Sorted(maps.Keys(g.NamedLogs())))
+	assert.Equal(t, 2, len(g.logs()))
+	assert.Equal(t, nil, g.Refresh(tNow.Add(time.Second), true))
+
+	var noRtc *TimeMemDb
+	_, errCreate = NewTimeGopher(tNow, true, true, noRtc, nil, nil, nil, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.NotEqual(t, nil, errCreate)
+}
 
 func TestCreateOrganizerMEM(t *testing.T) {
+	rtc, uncertain, start, stop, last := testMemLogs()
+	tNow := time.Unix(0, TESTEPOCH0)
+	dut, errCreate := NewTimeGopher(tNow, false, true, rtc, uncertain, start, stop, last, TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+
+	n, _ := uncertain.Len()
+	assert.Equal(t, 1, n) //Bad guess at cold start
+
+	tv, errConvert := dut.Convert(tNow.Add(time.Second))
+	assert.Equal(t, nil, errConvert)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 1000 + NsUptime(time.Second)}, tv)
+
+	tSynced := tNow.Add(time.Minute)
+	assert.Equal(t, nil, dut.Refresh(tSynced, true))
+	n, _ = rtc.Len()
+	assert.Equal(t, 1, n)
 
+	solved, errSolve := dut.Unconvert(tv)
+	assert.Equal(t, nil, errSolve)
+	assert.Equal(t, tNow.Add(time.Second).UnixNano(), solved.UnixNano())
 }
@@ -0,0 +1,412 @@
+/*
+Time journal
+
+Alternative storage for TimeGopher logs. All logs are stored as tagged records in one append-only journal.
+Journal is split to numbered segment files. Writes are not synced to disk on every insert, TimeGopher calls Sync
+once after each Refresh so one fsync covers all inserted entries.
+
+Content is kept in memory (same way as in TimeFileDb). When there are too many segments, journal writes all
+retained entries to new base segment and removes older segments.
+*/
+
+package timegopher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type JournalTag uint8
+
+const (
+	JOURNALTAG_BASE JournalTag = iota //Marks start of base segment, entries before that are obsolete
+	JOURNALTAG_UNCERTAINRTC
+	JOURNALTAG_RTC
+	JOURNALTAG_START
+	JOURNALTAG_STOP
+	JOURNALTAG_ALIVE
+)
+
+//tag(1)+boot(4)+uptime(8)+epoch(8)+crc32(4)
+const RECORDSIZE_JOURNAL = 25
+
+//TimeJournalConf tells how journal is stored
+//Name, is prefix for segment files. Segments are numbered _0, _1, _2 etc..
+//SegmentMaxSize, how many bytes one segment can have before new segment is started
+//MaxSegmentCount, when there are more segments, content is rewritten to new base segment
+//MaxRecords, how many latest entries are kept per tag when base segment is written. Zero is unlimited
+type TimeJournalConf struct {
+	Name            string
+	Path            string
+	SegmentMaxSize  int64
+	MaxSegmentCount int64
+	MaxRecords      map[JournalTag]int
+}
+
+//TimeJournal keeps journal file open and provides one JournalLog per tag
+type TimeJournal struct {
+	conf        TimeJournalConf
+	f           *os.File //Latest segment, appending here
+	segment     int64    //Number of latest segment
+	segmentSize int64
+	segments    []int64 //Numbers of segments on disk, ascending
+	dirty       bool    //Written but not synced
+	logs        map[JournalTag]*JournalLog
+}
+
+//JournalLog is TimeLog view to entries with one tag on journal
+type JournalLog struct {
+	TimeMemDb
+	journal *TimeJournal
+	tag     JournalTag
+}
+
+//journalStoreRTC tells what tags have epoch
+func journalStoreRTC(tag JournalTag) bool {
+	return tag == JOURNALTAG_RTC || tag == JOURNALTAG_UNCERTAINRTC
+}
+
+//CheckErrors tell is there problems with configuration
+func (p *TimeJournalConf) CheckErrors() error {
+	if len(p.Name) == 0 || strings.ContainsRune(p.Name, '/') {
+		return fmt.Errorf("invalid journal name %s", p.Name)
+	}
+	if p.SegmentMaxSize < RECORDSIZE_JOURNAL {
+		return fmt.Errorf("SegmentMaxSize(%v) < record size(%v)", p.SegmentMaxSize, RECORDSIZE_JOURNAL)
+	}
+	if p.MaxSegmentCount < 2 {
+		return fmt.Errorf("invalid MaxSegmentCount %v, at least 2 required", p.MaxSegmentCount)
+	}
+	return nil
+}
+
+func (p *TimeJournalConf) segmentFileName(n int64) string {
+	return path.Join(p.Path, fmt.Sprintf("%s_%v", p.Name, n))
+}
+
+//listSegments gets segment numbers on disk in ascending order
+func (p *TimeJournalConf) listSegments() ([]int64, error) {
+	entries, errDir := os.ReadDir(p.Path)
+	if errDir != nil {
+		return nil, errDir
+	}
+	result := []int64{}
+	prefix := p.Name + "_"
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		n, errParse := strconv.ParseInt(strings.TrimPrefix(entry.Name(), prefix), 10, 64)
+		if errParse == nil {
+			result = append(result, n)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+func encodeJournalRecord(tag JournalTag, t TimeVariable) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(byte(tag))
+	binary.Write(buf, binary.LittleEndian, t.BootNumber)
+	binary.Write(buf, binary.LittleEndian, t.Uptime)
+	binary.Write(buf, binary.LittleEndian, t.Epoch)
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes()
+}
+
+func parseJournalRecord(raw []byte) (JournalTag, TimeVariable, error) {
+	if len(raw) != RECORDSIZE_JOURNAL {
+		return 0, TimeVariable{}, fmt.Errorf("invalid size %v for journal record", len(raw))
+	}
+	if crc32.ChecksumIEEE(raw[0:21]) != binary.LittleEndian.Uint32(raw[21:25]) {
+		return 0, TimeVariable{}, fmt.Errorf("journal record checksum mismatch")
+	}
+	return JournalTag(raw[0]), TimeVariable{
+		BootNumber: int32(binary.LittleEndian.Uint32(raw[1:5])),
+		Uptime:     NsUptime(binary.LittleEndian.Uint64(raw[5:13])),
+		Epoch:      NsEpoch(binary.LittleEndian.Uint64(raw[13:21])),
+	}, nil
+}
+
+//InitTimeJournal opens journal, creates dir if required and restores all logs from segments
+func (p *TimeJournalConf) InitTimeJournal() (*TimeJournal, error) {
+	errConf := p.CheckErrors()
+	if errConf != nil {
+		return nil, errConf
+	}
+	errMkdir := os.MkdirAll(p.Path, os.ModePerm)
+	if errMkdir != nil {
+		return nil, fmt.Errorf("error creating dir %v err=%v", p.Path, errMkdir)
+	}
+	result := &TimeJournal{conf: *p}
+	result.resetLogs()
+
+	segments, errList := p.listSegments()
+	if errList != nil {
+		return nil, fmt.Errorf("error listing journal segments err=%v", errList)
+	}
+	for i, n := range segments {
+		raw, errRead := os.ReadFile(p.segmentFileName(n))
+		if errRead != nil {
+			return nil, errRead
+		}
+		isLatest := i == len(segments)-1
+		validSize, errRestore := result.restoreSegment(raw, isLatest)
+		if errRestore != nil {
+			return nil, fmt.Errorf("error restoring journal segment %v err=%v", n, errRestore)
+		}
+		if validSize < len(raw) { //Torn write at end of latest segment
+			errTruncate := os.Truncate(p.segmentFileName(n), int64(validSize))
+			if errTruncate != nil {
+				return nil, errTruncate
+			}
+		}
+		if 0 < validSize && raw[0] == byte(JOURNALTAG_BASE) { //Older segments are obsolete
+			errRemove := result.removeSegmentsBefore(segments, n)
+			if errRemove != nil {
+				return nil, errRemove
+			}
+		}
+	}
+	result.segments, errList = p.listSegments()
+	if errList != nil {
+		return nil, errList
+	}
+
+	if len(result.segments) == 0 {
+		return result, result.startSegment(0)
+	}
+	result.segment = result.segments[len(result.segments)-1]
+	var errOpen error
+	result.f, errOpen = os.OpenFile(p.segmentFileName(result.segment), os.O_WRONLY|os.O_APPEND, 0666)
+	if errOpen != nil {
+		return nil, errOpen
+	}
+	info, errStat := result.f.Stat()
+	if errStat != nil {
+		return nil, errStat
+	}
+	result.segmentSize = info.Size()
+	return result, nil
+}
+
+func (p *TimeJournal) resetLogs() {
+	p.logs = make(map[JournalTag]*JournalLog)
+	for _, tag := range []JournalTag{JOURNALTAG_UNCERTAINRTC, JOURNALTAG_RTC, JOURNALTAG_START, JOURNALTAG_STOP, JOURNALTAG_ALIVE} {
+		p.logs[tag] = &JournalLog{TimeMemDb: CreateTimeMemDb(journalStoreRTC(tag)), journal: p, tag: tag}
+	}
+}
+
+//restoreSegment appends segment content to logs. Returns how many bytes were valid. Only latest segment can have torn write at end
+func (p *TimeJournal) restoreSegment(raw []byte, isLatest bool) (int, error) {
+	for pos := 0; pos < len(raw); pos += RECORDSIZE_JOURNAL {
+		if len(raw) < pos+RECORDSIZE_JOURNAL {
+			if isLatest {
+				return pos, nil
+			}
+			return pos, fmt.Errorf("partial record at %v", pos)
+		}
+		tag, t, errParse := parseJournalRecord(raw[pos : pos+RECORDSIZE_JOURNAL])
+		if errParse != nil {
+			if isLatest && len(raw) < pos+2*RECORDSIZE_JOURNAL { //Only last record is allowed to be broken
+				return pos, nil
+			}
+			return pos, fmt.Errorf("%v at %v", errParse, pos)
+		}
+		if tag == JOURNALTAG_BASE {
+			if pos != 0 {
+				return pos, fmt.Errorf("base marker in middle of segment at %v", pos)
+			}
+			p.resetLogs()
+			continue
+		}
+		lg, haz := p.logs[tag]
+		if !haz {
+			return pos, fmt.Errorf("unknown tag %v at %v", tag, pos)
+		}
+		errAppend := lg.mem.checkAppend(t)
+		if errAppend != nil {
+			return pos, errAppend
+		}
+		lg.mem = append(lg.mem, t)
+	}
+	return len(raw), nil
+}
+
+func (p *TimeJournal) removeSegmentsBefore(segments []int64, n int64) error {
+	for _, old := range segments {
+		if n <= old {
+			break
+		}
+		errRemove := os.Remove(p.conf.segmentFileName(old))
+		if errRemove != nil && !os.IsNotExist(errRemove) {
+			return fmt.Errorf("error removing obsolete journal segment %v err=%v", old, errRemove)
+		}
+	}
+	return nil
+}
+
+//startSegment closes current segment and starts new empty segment
+func (p *TimeJournal) startSegment(n int64) error {
+	if p.f != nil {
+		errSync := p.Sync()
+		if errSync != nil {
+			return errSync
+		}
+		errClose := p.f.Close()
+		if errClose != nil {
+			return errClose
+		}
+	}
+	var errOpen error
+	p.f, errOpen = os.OpenFile(p.conf.segmentFileName(n), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if errOpen != nil {
+		return errOpen
+	}
+	p.segment = n
+	p.segmentSize = 0
+	p.segments = append(p.segments, n)
+	return nil
+}
+
+//writeBase writes all retained entries to new segment starting with base marker, then removes older segments
+func (p *TimeJournal) writeBase() error {
+	buf := new(bytes.Buffer)
+	buf.Write(encodeJournalRecord(JOURNALTAG_BASE, TimeVariable{}))
+	for _, tag := range []JournalTag{JOURNALTAG_UNCERTAINRTC, JOURNALTAG_RTC, JOURNALTAG_START, JOURNALTAG_STOP, JOURNALTAG_ALIVE} {
+		lg := p.logs[tag]
+		maxRecords := p.conf.MaxRecords[tag]
+		if 0 < maxRecords {
+			lg.mem = append(TimeVariableList{}, lg.mem.latestN(maxRecords)...)
+		}
+		for _, t := range lg.mem {
+			buf.Write(encodeJournalRecord(tag, t))
+		}
+	}
+
+	oldSegments := p.segments
+	n := p.segment + 1
+	tmpName := p.conf.segmentFileName(n) + "_TMP"
+	errWrite := writeFileSync(tmpName, buf.Bytes())
+	if errWrite != nil {
+		return errWrite
+	}
+	errRename := os.Rename(tmpName, p.conf.segmentFileName(n))
+	if errRename != nil {
+		return errRename
+	}
+	p.segments = []int64{}
+	errStart := p.startSegment(n) //Opens written base file for appending
+	if errStart != nil {
+		return errStart
+	}
+	p.segmentSize = int64(buf.Len())
+	return p.removeSegmentsBefore(oldSegments, n)
+}
+
+//writeFileSync writes file and syncs it before closing
+func writeFileSync(filename string, content []byte) error {
+	return openWriteSync(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, content)
+}
+
+//appendFileSync appends to end of file and syncs it before closing
+func appendFileSync(filename string, content []byte) error {
+	return openWriteSync(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, content)
+}
+
+func openWriteSync(filename string, flag int, content []byte) error {
+	f, errOpen := os.OpenFile(filename, flag, 0666)
+	if errOpen != nil {
+		return errOpen
+	}
+	_, errWrite := f.Write(content)
+	if errWrite != nil {
+		f.Close()
+		return errWrite
+	}
+	errSync := f.Sync()
+	if errSync != nil {
+		f.Close()
+		return errSync
+	}
+	return f.Close()
+}
+
+//append writes record to latest segment without syncing
+func (p *TimeJournal) append(tag JournalTag, t TimeVariable) error {
+	if p.conf.SegmentMaxSize <= p.segmentSize {
+		var errRotate error
+		if p.conf.MaxSegmentCount <= int64(len(p.segments)) {
+			errRotate = p.writeBase()
+		} else {
+			errRotate = p.startSegment(p.segment + 1)
+		}
+		if errRotate != nil {
+			return fmt.Errorf("journal rotate error %v", errRotate)
+		}
+	}
+	n, errWrite := p.f.Write(encodeJournalRecord(tag, t))
+	p.segmentSize += int64(n)
+	p.dirty = true
+	return errWrite
+}
+
+//Log gives TimeLog for tag
+func (p *TimeJournal) Log(tag JournalTag) *JournalLog {
+	return p.logs[tag]
+}
+
+//Sync flushes written entries to disk. Does nothing if there are no new entries
+func (p *TimeJournal) Sync() error {
+	if !p.dirty {
+		return nil
+	}
+	errSync := p.f.Sync()
+	if errSync != nil {
+		return errSync
+	}
+	p.dirty = false
+	return nil
+}
+
+//Close syncs and closes journal
+func (p *TimeJournal) Close() error {
+	errSync := p.Sync()
+	if errSync != nil {
+		return errSync
+	}
+	return p.f.Close()
+}
+
+func (p *JournalLog) Insert(t TimeVariable) error {
+	_, errbin := t.ToBinary(p.storeRTC) //Same sanity checks as on disk
+	if errbin != nil {
+		return fmt.Errorf("Insert error, binary coding %#v failed %v", t, errbin)
+	}
+	errAppend := p.mem.checkAppend(t)
+	if errAppend != nil {
+		return errAppend
+	}
+	if !p.storeRTC {
+		t.Epoch = 0
+	}
+	errWrite := p.journal.append(p.tag, t)
+	if errWrite != nil {
+		return errWrite
+	}
+	p.mem = append(p.mem, t)
+	return nil
+}
+
+//Sync flushes whole journal. Implements TimeLogSyncer
+func (p *JournalLog) Sync() error {
+	return p.journal.Sync()
+}
@@ -0,0 +1,94 @@
+package timegopher
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testJournalConf(dir string) TimeJournalConf {
+	return TimeJournalConf{
+		Name:            "test.journal",
+		Path:            dir,
+		SegmentMaxSize:  RECORDSIZE_JOURNAL * 4,
+		MaxSegmentCount: 3,
+		MaxRecords:      map[JournalTag]int{JOURNALTAG_ALIVE: 2},
+	}
+}
+
+func TestJournalRestore(t *testing.T) {
+	dir := t.TempDir()
+	conf := testJournalConf(dir)
+	journal, errInit := conf.InitTimeJournal()
+	assert.Equal(t, nil, errInit)
+
+	rtc := journal.Log(JOURNALTAG_RTC)
+	alive := journal.Log(JOURNALTAG_ALIVE)
+	for i := 1; i <= 20; i++ {
+		assert.Equal(t, nil, rtc.Insert(TimeVariable{BootNumber: 1, Uptime: NsUptime(i * 1000), Epoch: TESTEPOCH0 + NsEpoch(i*1000)}))
+		assert.Equal(t, nil, alive.Insert(TimeVariable{BootNumber: 1, Uptime: NsUptime(i * 1000), Epoch: 42})) //Epoch is dropped
+	}
+	assert.NotNil(t, rtc.Insert(TimeVariable{BootNumber: 1, Uptime: 10, Epoch: TESTEPOCH0}))
+	assert.Equal(t, nil, rtc.Sync())
+
+	segments, _ := conf.listSegments()
+	assert.LessOrEqual(t, len(segments), 3)
+
+	rtcArr, _ := rtc.All()
+	aliveArr, _ := alive.All()
+	assert.Equal(t, 20, len(rtcArr))
+	assert.LessOrEqual(t, len(aliveArr), 20)
+	assert.Equal(t, TimeVariable{BootNumber: 1, Uptime: 20000}, aliveArr[len(aliveArr)-1])
+	assert.Equal(t, nil, journal.Close())
+
+	restored, errRestore := conf.InitTimeJournal()
+	assert.Equal(t, nil, errRestore)
+	restoredRtc, _ := restored.Log(JOURNALTAG_RTC).All()
+	restoredAlive, _ := restored.Log(JOURNALTAG_ALIVE).All()
+	assert.Equal(t, rtcArr, restoredRtc)
+	assert.Equal(t, aliveArr, restoredAlive)
+	assert.Equal(t, nil, restored.Close())
+}
+
+func TestJournalTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	conf := testJournalConf(dir)
+	conf.SegmentMaxSize = 1024
+	journal, _ := conf.InitTimeJournal()
+	start := journal.Log(JOURNALTAG_START)
+	assert.Equal(t, nil, start.Insert(TimeVariable{BootNumber: 1, Uptime: 100}))
+	assert.Equal(t, nil, start.Insert(TimeVariable{BootNumber: 2, Uptime: 100}))
+	assert.Equal(t, nil, journal.Close())
+
+	f, _ := os.OpenFile(conf.segmentFileName(0), os.O_WRONLY|os.O_APPEND, 0666)
+	f.Write(encodeJournalRecord(JOURNALTAG_START, TimeVariable{BootNumber: 3, Uptime: 100})[0:10])
+	f.Close()
+
+	restored, errRestore := conf.InitTimeJournal()
+	assert.Equal(t, nil, errRestore)
+	n, _ := restored.Log(JOURNALTAG_START).Len()
+	assert.Equal(t, 2, n)
+	assert.Equal(t, nil, restored.Log(JOURNALTAG_START).Insert(TimeVariable{BootNumber: 3, Uptime: 100}))
+	assert.Equal(t, nil, restored.Close())
+
+	again, errAgain := conf.InitTimeJournal()
+	assert.Equal(t, nil, errAgain)
+	n, _ = again.Log(JOURNALTAG_START).Len()
+	assert.Equal(t, 3, n)
+	again.Close()
+}
+
+func TestJournalTimeGopher(t *testing.T) {
+	conf := testJournalConf(t.TempDir())
+	journal, _ := conf.InitTimeJournal()
+	tNow := time.Unix(0, TESTEPOCH0)
+	dut, errCreate := NewTimeGopher(tNow, true, true,
+		journal.Log(JOURNALTAG_RTC), journal.Log(JOURNALTAG_UNCERTAINRTC), journal.Log(JOURNALTAG_START),
+		journal.Log(JOURNALTAG_STOP), journal.Log(JOURNALTAG_ALIVE), TimeVariable{}, testUptimeChecker(tNow, 1000))
+	assert.Equal(t, nil, errCreate)
+	assert.Equal(t, nil, dut.Refresh(tNow.Add(time.Second), true))
+	assert.Equal(t, false, journal.dirty) //Refresh synced
+	journal.Close()
+}
@@ -0,0 +1,118 @@
+/*
+TimeLog is interface for storing and searching TimeVariables.
+
+TimeGopher uses TimeLog for all its logs, so storage can be provided by application (like inside own key-value store).
+TimeFileDb is default implementation on top of fixregsto. TimeMemDb keeps content only in memory (for tests and volatile use)
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+type TimeLog interface {
+	Insert(t TimeVariable) error //Only cumulative values, t must be after latest entry
+	GetLatestN(n int) ([]TimeVariable, error)
+	GetFirstN(n int) ([]TimeVariable, error)
+	GetOnBoot(boot int32) ([]TimeVariable, error)
+	All() ([]TimeVariable, error) //For iterating all entries, oldest first
+	Len() (int, error)
+
+	Range(from TimeVariable, to TimeVariable) ([]TimeVariable, error) //From (included) to (not included) by boot and uptime
+	RangeEpoch(from NsEpoch, to NsEpoch) ([]TimeVariable, error)      //Entries with epoch from (included) to (not included)
+	Forward() iter.Seq2[TimeVariable, error]                          //Oldest first, without copying whole log. Stops after error
+	Backward() iter.Seq2[TimeVariable, error]                         //Latest first
+
+	SolveEpoch(boot int32, uptime NsUptime) (NsEpoch, error)
+	SolveBootNumber(epoch NsEpoch) (int32, error)
+	SearchTimeVariable(epoch NsEpoch) (TimeVariable, error)
+}
+
+//isNilLog detects also typed nil like (*TimeFileDb)(nil), that is not equal to nil interface
+func isNilLog(db TimeLog) bool {
+	if db == nil {
+		return true
+	}
+	v := reflect.ValueOf(db)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Interface, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+//optionalLog converts typed nil to nil interface, so log can be checked against nil
+func optionalLog(db TimeLog) TimeLog {
+	if isNilLog(db) {
+		return nil
+	}
+	return db
+}
+
+//TimeLogSyncer is optional interface for TimeLog implementations that buffer writes.
+//TimeGopher calls Sync once after operation (like Refresh) have inserted all its entries
+type TimeLogSyncer interface {
+	Sync() error
+}
+
+//TimeMemDb is TimeLog implementation keeping entries only in memory
+type TimeMemDb struct {
+	storeRTC bool //false= only boot and uptime
+	mem      TimeVariableList
+}
+
+//CreateTimeMemDb creates empty in-memory TimeLog. Entries are validated same way as on TimeFileDb
+func CreateTimeMemDb(storeRTC bool) TimeMemDb {
+	return TimeMemDb{storeRTC: storeRTC, mem: TimeVariableList{}}
+}
+
+func (p *TimeMemDb) Insert(t TimeVariable) error {
+	_, errbin := t.ToBinary(p.storeRTC) //Same sanity checks as on disk
+	if errbin != nil {
+		return fmt.Errorf("Insert error, binary coding %#v failed %v", t, errbin)
+	}
+	errAppend := p.mem.checkAppend(t)
+	if errAppend != nil {
+		return errAppend
+	}
+	if !p.storeRTC {
+		t.Epoch = 0
+	}
+	p.mem = append(p.mem, t)
+	return nil
+}
+
+func (p *TimeMemDb) GetLatestN(n int) ([]TimeVariable, error) {
+	return p.mem.latestN(n), nil
+}
+
+func (p *TimeMemDb) GetFirstN(n int) ([]TimeVariable, error) {
+	return p.mem.firstN(n), nil
+}
+
+func (p *TimeMemDb) GetOnBoot(boot int32) ([]TimeVariable, error) {
+	return p.mem.GetVariablesInBoot(boot), nil
+}
+
+func (p *TimeMemDb) All() ([]TimeVariable, error) {
+	return p.mem, nil
+}
+
+func (p *TimeMemDb) Len() (int, error) {
+	return p.mem.Len(), nil
+}
+
+func (p *TimeMemDb) SolveEpoch(boot int32, uptime NsUptime) (NsEpoch, error) {
+	return p.mem.SolveEpoch(boot, uptime)
+}
+
+func (p *TimeMemDb) SolveBootNumber(epoch NsEpoch) (int32, error) {
+	return p.mem.SolveBootNumber(epoch)
+}
+
+func (p *TimeMemDb) SearchTimeVariable(epoch NsEpoch) (TimeVariable, error) {
+	return p.mem.SearchTimeVariable(epoch)
+}
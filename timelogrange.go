@@ -0,0 +1,209 @@
+/*
+Range queries and iterators for TimeLogs
+
+Range and RangeEpoch replace reading everything with GetFirstN or All. Forward and Backward iterate without
+copying whole log (BoundedTimeFileDb reads entries from storage by windows while iterating). Read error is
+given as last value of iteration
+*/
+
+package timegopher
+
+import (
+	"fmt"
+	"iter"
+	"sort"
+)
+
+//lessBootUptime orders by boot and uptime, like TimeVariableList.Less. Epoch is not used
+func lessBootUptime(a TimeVariable, b TimeVariable) bool {
+	if a.BootNumber == b.BootNumber {
+		return a.Uptime < b.Uptime
+	}
+	return a.BootNumber < b.BootNumber
+}
+
+//inRange tells is t between from (included) and to (not included)
+func inRange(t TimeVariable, from TimeVariable, to TimeVariable) bool {
+	return !lessBootUptime(t, from) && lessBootUptime(t, to)
+}
+
+//inRangeEpoch tells is epoch of t between from (included) and to (not included)
+func inRangeEpoch(t TimeVariable, from NsEpoch, to NsEpoch) bool {
+	return from <= t.Epoch && t.Epoch < to
+}
+
+//Range gives entries from (included) to (not included), compared by boot and uptime. List must be in order. Result shares memory with list
+func (p TimeVariableList) Range(from TimeVariable, to TimeVariable) TimeVariableList {
+	start := sort.Search(len(p), func(i int) bool { return !lessBootUptime(p[i], from) })
+	end := sort.Search(len(p), func(i int) bool { return !lessBootUptime(p[i], to) })
+	if end < start {
+		end = start
+	}
+	return p[start:end]
+}
+
+//RangeEpoch gives entries having epoch from (included) to (not included). Entries without epoch are not included
+func (p TimeVariableList) RangeEpoch(from NsEpoch, to NsEpoch) TimeVariableList {
+	result := TimeVariableList{}
+	for _, t := range p {
+		if inRangeEpoch(t, from, to) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+//Forward iterates oldest first
+func (p TimeVariableList) Forward() iter.Seq[TimeVariable] {
+	return func(yield func(TimeVariable) bool) {
+		for _, t := range p {
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+//Backward iterates latest first
+func (p TimeVariableList) Backward() iter.Seq[TimeVariable] {
+	return func(yield func(TimeVariable) bool) {
+		for i := len(p) - 1; 0 <= i; i-- {
+			if !yield(p[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (p *TimeMemDb) Range(from TimeVariable, to TimeVariable) ([]TimeVariable, error) {
+	return p.mem.Range(from, to), nil
+}
+
+func (p *TimeMemDb) RangeEpoch(from NsEpoch, to NsEpoch) ([]TimeVariable, error) {
+	return p.mem.RangeEpoch(from, to), nil
+}
+
+//withoutErr is iterator of TimeLog from iterator that can not fail
+func withoutErr(seq iter.Seq[TimeVariable]) iter.Seq2[TimeVariable, error] {
+	return func(yield func(TimeVariable, error) bool) {
+		for t := range seq {
+			if !yield(t, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (p *TimeMemDb) Forward() iter.Seq2[TimeVariable, error] {
+	return withoutErr(p.mem.Forward())
+}
+
+func (p *TimeMemDb) Backward() iter.Seq2[TimeVariable, error] {
+	return withoutErr(p.mem.Backward())
+}
+
+func (p *TimeFileDb) Range(from TimeVariable, to TimeVariable) ([]TimeVariable, error) {
+	return p.mem.Range(from, to), nil
+}
+
+func (p *TimeFileDb) RangeEpoch(from NsEpoch, to NsEpoch) ([]TimeVariable, error) {
+	return p.mem.RangeEpoch(from, to), nil
+}
+
+func (p *TimeFileDb) Forward() iter.Seq2[TimeVariable, error] {
+	return withoutErr(p.mem.Forward())
+}
+
+func (p *TimeFileDb) Backward() iter.Seq2[TimeVariable, error] {
+	return withoutErr(p.mem.Backward())
+}
+
+//searchIndex gives index of first entry that is not before t (by boot and uptime). Bisects entries on storage
+func (p *BoundedTimeFileDb) searchIndex(t TimeVariable) (int, error) {
+	lo, hi := 0, p.total
+	for lo < hi {
+		mid := (lo + hi) / 2
+		entry, errRead := p.readEntry(mid)
+		if errRead != nil {
+			return 0, errRead
+		}
+		if lessBootUptime(entry, t) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+//Range searches start of range from storage, only entries on range are kept in memory
+func (p *BoundedTimeFileDb) Range(from TimeVariable, to TimeVariable) ([]TimeVariable, error) {
+	result := TimeVariableList{}
+	if !lessBootUptime(from, to) {
+		return result, nil
+	}
+	start, errStart := p.searchIndex(from)
+	if errStart != nil {
+		return result, errStart
+	}
+	if p.total <= start {
+		return result, nil
+	}
+	errScan := p.scan(start, func(index int, t TimeVariable) bool {
+		if !lessBootUptime(t, to) {
+			return false
+		}
+		result = append(result, t)
+		return true
+	})
+	return result, errScan
+}
+
+//RangeEpoch scans storage, only matching entries are kept in memory
+func (p *BoundedTimeFileDb) RangeEpoch(from NsEpoch, to NsEpoch) ([]TimeVariable, error) {
+	result := TimeVariableList{}
+	errScan := p.scan(0, func(index int, t TimeVariable) bool {
+		if inRangeEpoch(t, from, to) {
+			result = append(result, t)
+		}
+		return true
+	})
+	return result, errScan
+}
+
+//Forward reads entries from storage while iterating. Do not insert while iterating
+func (p *BoundedTimeFileDb) Forward() iter.Seq2[TimeVariable, error] {
+	return func(yield func(TimeVariable, error) bool) {
+		stopped := false
+		errScan := p.scan(0, func(index int, t TimeVariable) bool {
+			stopped = !yield(t, nil)
+			return !stopped
+		})
+		if errScan != nil && !stopped {
+			yield(TimeVariable{}, errScan)
+		}
+	}
+}
+
+//Backward reads windows of entries from storage, latest first. Do not insert while iterating
+func (p *BoundedTimeFileDb) Backward() iter.Seq2[TimeVariable, error] {
+	return func(yield func(TimeVariable, error) bool) {
+		for end := p.total; 0 < end; {
+			start := max(0, end-boundedScanChunk)
+			arr, errArr := p.readRange(start, end-start)
+			if errArr == nil && len(arr) != end-start {
+				errArr = fmt.Errorf("index mismatch, got %v entries from %v expected %v", len(arr), start, end-start)
+			}
+			if errArr != nil {
+				yield(TimeVariable{}, errArr)
+				return
+			}
+			for t := range arr.Backward() {
+				if !yield(t, nil) {
+					return
+				}
+			}
+			end = start
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package timegopher
+
+import (
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+//testCollect collects entries from TimeLog iterator until error
+func testCollect(seq iter.Seq2[TimeVariable, error]) ([]TimeVariable, error) {
+	result := []TimeVariable{}
+	for tv, err := range seq {
+		if err != nil {
+			return result, err
+		}
+		result = append(result, tv)
+	}
+	return result, nil
+}
+
+func TestTimeLogRange(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 100}
+	memFile, _ := memconf.InitMemLoop()
+	memBounded, _ := memconf.InitMemLoop()
+	fileDb, _ := CreateTimeFileDb(&memFile, true)
+	boundedDb, _ := CreateBoundedTimeFileDb(&memBounded, true, 4)
+	memDb := CreateTimeMemDb(true)
+	journalConf := testJournalConf(t.TempDir())
+	journal, errJournal := journalConf.InitTimeJournal()
+	assert.Equal(t, nil, errJournal)
+	defer journal.Close()
+
+	dbs := map[string]TimeLog{"mem": &memDb, "file": &fileDb, "bounded": &boundedDb, "journal": journal.Log(JOURNALTAG_RTC)}
+	all := TimeVariableList{}
+	for boot := int32(1); boot <= 4; boot++ {
+		for i := 1; i <= 5; i++ {
+			all = append(all, TimeVariable{BootNumber: boot, Uptime: NsUptime(i * 1000), Epoch: TESTEPOCH0 + NsEpoch(int(boot)*100000+i*1000)})
+		}
+	}
+	for _, db := range dbs {
+		for _, tv := range all {
+			assert.Equal(t, nil, db.Insert(tv))
+		}
+	}
+
+	for name, db := range dbs {
+		arr, errRange := db.Range(TimeVariable{BootNumber: 2, Uptime: 3000}, TimeVariable{BootNumber: 3, Uptime: 2000})
+		assert.Equal(t, nil, errRange, name)
+		assert.Equal(t, []TimeVariable(all[7:11]), arr, name)
+
+		//Bounds between entries and outside of log
+		arr, _ = db.Range(TimeVariable{BootNumber: 3, Uptime: 4500}, TimeVariable{BootNumber: 9})
+		assert.Equal(t, []TimeVariable(all[14:]), arr, name)
+		arr, _ = db.Range(TimeVariable{BootNumber: 3}, TimeVariable{BootNumber: 2})
+		assert.Equal(t, 0, len(arr), name)
+
+		arr, errEpoch := db.RangeEpoch(TESTEPOCH0+200000, TESTEPOCH0+302000)
+		assert.Equal(t, nil, errEpoch, name)
+		assert.Equal(t, []TimeVariable(all[5:11]), arr, name)
+
+		forward, errForward := testCollect(db.Forward())
+		assert.Equal(t, nil, errForward, name)
+		assert.Equal(t, []TimeVariable(all), forward, name)
+		backward, errBackward := testCollect(db.Backward())
+		assert.Equal(t, nil, errBackward, name)
+		slices.Reverse(backward)
+		assert.Equal(t, []TimeVariable(all), backward, name)
+
+		//Stop iteration early
+		first := []TimeVariable{}
+		for tv := range db.Forward() {
+			if 3 <= len(first) {
+				break
+			}
+			first = append(first, tv)
+		}
+		assert.Equal(t, []TimeVariable(all[0:3]), first, name)
+		latest := []TimeVariable{}
+		for tv := range db.Backward() {
+			latest = append(latest, tv)
+			if len(latest) == 7 {
+				break
+			}
+		}
+		assert.Equal(t, all[len(all)-1], latest[0], name)
+		assert.Equal(t, all[len(all)-7], latest[6], name)
+	}
+}
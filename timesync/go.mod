@@ -2,9 +2,15 @@ module github.com/hjkoskel/timegopher/timesync
 
 go 1.23.2
 
-require github.com/beevik/ntp v1.4.3
+require (
+	github.com/beevik/ntp v1.4.3
+	github.com/stretchr/testify v1.9.0
+)
 
 require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
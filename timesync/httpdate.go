@@ -0,0 +1,128 @@
+package timesync
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//Date header have one second resolution. More requests timed near second transition gives better resolution
+const HTTPDATE_DEFAULTREQUESTS = 6
+
+//HttpDateSync gets time from HTTP Date response headers. For sites where only HTTPS is allowed
+type HttpDateSync struct {
+	Urls     []string //Tried in order until one works
+	Client   *http.Client
+	Requests int //Requests per measurement. Default HTTPDATE_DEFAULTREQUESTS
+}
+
+//HttpDateEstimate is offset interval consistent with all responses
+type HttpDateEstimate struct {
+	Url           string
+	Offset        time.Duration //Middle of interval
+	ErrorEstimate time.Duration //Half of interval
+	Requests      int
+	RTT           time.Duration //Latest request
+	Time          time.Time     //Local clock at end of measurement
+}
+
+func (p *HttpDateSync) SourceKind() string {
+	return "http"
+}
+
+//sample requests url once. Returns offset interval and round trip time
+func (p *HttpDateSync) sample(url string) (time.Duration, time.Duration, time.Duration, error) {
+	t0 := time.Now()
+	resp, errReq := p.Client.Head(url)
+	t1 := time.Now()
+	if errReq != nil {
+		return 0, 0, 0, errReq
+	}
+	resp.Body.Close()
+	date, errDate := http.ParseTime(resp.Header.Get("Date"))
+	if errDate != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Date header %v", errDate)
+	}
+	//Server made header between t0 and t1, its clock was between date and date+1s
+	return date.Sub(t1), date.Add(time.Second).Sub(t0), t1.Sub(t0), nil
+}
+
+//estimate narrows offset interval by timing requests so that server second changes at middle of request
+func (p *HttpDateSync) estimate(url string, requests int) (HttpDateEstimate, error) {
+	result := HttpDateEstimate{Url: url}
+	lo, hi, rtt, err := p.sample(url)
+	if err != nil {
+		return result, err
+	}
+	result.Requests = 1
+	for result.Requests < requests {
+		mid := (lo + hi) / 2
+		//Next server second that can be reached, with some margin
+		serverNow := time.Now().Add(rtt/2 + mid + 10*time.Millisecond)
+		boundary := serverNow.Truncate(time.Second).Add(time.Second)
+		time.Sleep(time.Until(boundary.Add(-mid - rtt/2)))
+
+		sampleLo, sampleHi, sampleRtt, errSample := p.sample(url)
+		if errSample != nil {
+			return result, errSample
+		}
+		result.Requests++
+		rtt = sampleRtt
+		if lo < sampleLo {
+			lo = sampleLo
+		}
+		if sampleHi < hi {
+			hi = sampleHi
+		}
+		if hi < lo {
+			return result, fmt.Errorf("inconsistent Date headers from %s", url)
+		}
+	}
+	result.Offset = (lo + hi) / 2
+	result.ErrorEstimate = (hi - lo) / 2
+	result.RTT = rtt
+	result.Time = time.Now()
+	return result, nil
+}
+
+//GetEstimate measures offset from first url that works
+func (p *HttpDateSync) GetEstimate() (HttpDateEstimate, error) {
+	if p.Client == nil {
+		p.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	requests := p.Requests
+	if requests < 1 {
+		requests = HTTPDATE_DEFAULTREQUESTS
+	}
+	errList := []string{}
+	for _, url := range p.Urls {
+		result, err := p.estimate(url, requests)
+		if err == nil {
+			return result, nil
+		}
+		errList = append(errList, fmt.Sprintf("url:%s error: %s", url, err))
+	}
+	return HttpDateEstimate{}, fmt.Errorf("failed HTTP Date urls [%s]", strings.Join(errList, ","))
+}
+
+func (p *HttpDateSync) GetOffset() (time.Duration, error) {
+	est, err := p.GetEstimate()
+	return est.Offset, err
+}
+
+func (p *HttpDateSync) GetSample() (SyncSample, error) {
+	est, err := p.GetEstimate()
+	if err != nil {
+		return SyncSample{}, err
+	}
+	return SyncSample{
+		Offset:        est.Offset,
+		ErrorEstimate: est.ErrorEstimate,
+		Source:        p.SourceKind(),
+		Server:        est.Url,
+		RTT:           est.RTT,
+		Precision:     time.Second, //Resolution of Date header
+		Time:          est.Time,
+	}, nil
+}
@@ -0,0 +1,32 @@
+package timesync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpDateSync(t *testing.T) {
+	offset := 3*time.Second + 700*time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(offset).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	dut := HttpDateSync{Urls: []string{closed.URL, server.URL}, Requests: 5}
+	est, err := dut.GetEstimate()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, server.URL, est.Url)
+	assert.Equal(t, 5, est.Requests)
+	assert.InDelta(t, float64(offset), float64(est.Offset), float64(100*time.Millisecond))
+	assert.Less(t, est.ErrorEstimate, 100*time.Millisecond)
+
+	dut.Urls = []string{closed.URL}
+	_, err = dut.GetOffset()
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,177 @@
+package timesync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NMEA_DEFAULTSAMPLES      = 5  //Time sentences per measurement
+	NMEA_DEFAULTMAXSENTENCES = 50 //Sentences read before giving up
+)
+
+//Receiver sends sentences once per second. Read that waits this long is not from buffer
+const NMEA_DEFAULTREADGAP = 200 * time.Millisecond
+
+//NmeaSync reads time from GPS receiver NMEA output ($GPRMC, $GNRMC and $GPZDA). Reader is serial port or recorded file.
+//Sentences arrive some time after second they describe. Latency is that delay without buffering.
+//Buffering only delays arrival so maximum offset over sentences is used.
+//Sentences queued between calls are discarded. Timing starts after read that waited at least ReadGap
+type NmeaSync struct {
+	Reader       io.Reader
+	Latency      time.Duration    //Delay from start of second to end of sentence
+	Samples      int              //Default NMEA_DEFAULTSAMPLES
+	MaxSentences int              //Default NMEA_DEFAULTMAXSENTENCES, buffered sentences are not counted
+	ReadGap      time.Duration    //Default NMEA_DEFAULTREADGAP. Negative uses all sentences (recorded files)
+	Now          func() time.Time //For testing, default time.Now
+
+	scanner  *bufio.Scanner
+	fixValid bool //Status of latest RMC. ZDA does not tell validity
+}
+
+func (p *NmeaSync) SourceKind() string {
+	return "gps"
+}
+
+//nmeaChecksumOk checks $...*HH sentence
+func nmeaChecksumOk(sentence string) bool {
+	star := strings.LastIndex(sentence, "*")
+	if !strings.HasPrefix(sentence, "$") || star < 0 || len(sentence) != star+3 {
+		return false
+	}
+	expected, errParse := strconv.ParseUint(sentence[star+1:], 16, 8)
+	if errParse != nil {
+		return false
+	}
+	sum := byte(0)
+	for i := 1; i < star; i++ {
+		sum ^= sentence[i]
+	}
+	return sum == byte(expected)
+}
+
+//parseNmeaClock parses hhmmss.ss
+func parseNmeaClock(s string) (int, int, int, int, error) {
+	if len(s) < 6 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid time %s", s)
+	}
+	h, errH := strconv.Atoi(s[0:2])
+	m, errM := strconv.Atoi(s[2:4])
+	sec, errSec := strconv.ParseFloat(s[4:], 64)
+	if errH != nil || errM != nil || errSec != nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid time %s", s)
+	}
+	whole := int(sec)
+	return h, m, whole, int((sec - float64(whole)) * 1e9), nil
+}
+
+//parseNmeaTime parses time from RMC or ZDA sentence. Returns false if sentence does not have valid time
+func (p *NmeaSync) parseNmeaTime(sentence string) (time.Time, bool) {
+	if !nmeaChecksumOk(sentence) {
+		return time.Time{}, false
+	}
+	fields := strings.Split(sentence[1:strings.LastIndex(sentence, "*")], ",")
+	if len(fields[0]) != 5 {
+		return time.Time{}, false
+	}
+	switch fields[0][2:] {
+	case "RMC":
+		if len(fields) < 10 {
+			return time.Time{}, false
+		}
+		p.fixValid = fields[2] == "A"
+		if !p.fixValid || len(fields[9]) != 6 {
+			return time.Time{}, false
+		}
+		h, m, s, ns, errClock := parseNmeaClock(fields[1])
+		day, errDay := strconv.Atoi(fields[9][0:2])
+		month, errMonth := strconv.Atoi(fields[9][2:4])
+		year, errYear := strconv.Atoi(fields[9][4:6])
+		if errClock != nil || errDay != nil || errMonth != nil || errYear != nil {
+			return time.Time{}, false
+		}
+		return time.Date(2000+year, time.Month(month), day, h, m, s, ns, time.UTC), true
+	case "ZDA":
+		if !p.fixValid || len(fields) < 5 {
+			return time.Time{}, false
+		}
+		h, m, s, ns, errClock := parseNmeaClock(fields[1])
+		day, errDay := strconv.Atoi(fields[2])
+		month, errMonth := strconv.Atoi(fields[3])
+		year, errYear := strconv.Atoi(fields[4])
+		if errClock != nil || errDay != nil || errMonth != nil || errYear != nil {
+			return time.Time{}, false
+		}
+		return time.Date(year, time.Month(month), day, h, m, s, ns, time.UTC), true
+	}
+	return time.Time{}, false
+}
+
+func (p *NmeaSync) GetOffset() (time.Duration, error) {
+	sample, err := p.GetSample()
+	return sample.Offset, err
+}
+
+//GetSample is GetOffset with metadata. Time is reading time of least delayed sentence
+func (p *NmeaSync) GetSample() (SyncSample, error) {
+	result := SyncSample{Source: p.SourceKind(), Server: "nmea"}
+	if p.scanner == nil {
+		p.scanner = bufio.NewScanner(p.Reader)
+	}
+	now := p.Now
+	if now == nil {
+		now = time.Now
+	}
+	samples := p.Samples
+	if samples < 1 {
+		samples = NMEA_DEFAULTSAMPLES
+	}
+	maxSentences := p.MaxSentences
+	if maxSentences < 1 {
+		maxSentences = NMEA_DEFAULTMAXSENTENCES
+	}
+
+	readGap := p.ReadGap
+	if readGap == 0 {
+		readGap = NMEA_DEFAULTREADGAP
+	}
+
+	fresh := readGap < 0
+	tPrev := now()
+	got := 0
+	for i := 0; i < maxSentences && got < samples; i++ {
+		if !p.scanner.Scan() {
+			if p.scanner.Err() != nil {
+				return result, fmt.Errorf("reading NMEA failed err=%v", p.scanner.Err())
+			}
+			break
+		}
+		tRead := now()
+		if !fresh {
+			fresh = readGap <= tRead.Sub(tPrev)
+			tPrev = tRead
+			if !fresh { //Was queued on buffer, arrival time is not known
+				i--
+				continue
+			}
+		}
+		gpsTime, valid := p.parseNmeaTime(strings.TrimSpace(p.scanner.Text()))
+		if !valid {
+			continue
+		}
+		offset := gpsTime.Add(p.Latency).Sub(tRead)
+		if got == 0 || result.Offset < offset {
+			result.Offset = offset
+			result.Time = tRead
+		}
+		got++
+	}
+	if got == 0 {
+		return result, fmt.Errorf("no valid NMEA time sentences")
+	}
+	return result, nil
+}
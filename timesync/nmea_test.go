@@ -0,0 +1,92 @@
+package timesync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//testNmea adds checksum to sentence body
+func testNmea(body string) string {
+	sum := byte(0)
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X", body, sum)
+}
+
+func TestNmeaChecksum(t *testing.T) {
+	assert.True(t, nmeaChecksumOk("$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A"))
+	assert.False(t, nmeaChecksumOk("$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6B"))
+	assert.False(t, nmeaChecksumOk("$GPRMC,123519,A"))
+}
+
+func TestNmeaSync(t *testing.T) {
+	recorded := strings.Join([]string{
+		testNmea("GPZDA,101500.00,20,07,2022,00,00"),                                //No fix known yet
+		testNmea("GPRMC,101500.00,V,,,,,,,200722,,,N"),                              //No fix
+		"$GPRMC,101501.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A*00",           //Bad checksum
+		testNmea("GNRMC,101502.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"),     //Valid
+		testNmea("GPGGA,101502.00,6027.000,N,02500.000,E,1,08,0.9,10.0,M,17.0,M,,"), //Not time sentence
+		testNmea("GPZDA,101502.00,20,07,2022,00,00"),                                //Buffered, arrives late
+		testNmea("GNRMC,101503.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"),     //Valid
+	}, "\r\n")
+
+	//Local clock is 2s behind. Sentences arrive 100ms after second, except ZDA that is late. Call starts before first sentence
+	local := time.Date(2022, 7, 20, 10, 15, 0, 0, time.UTC).Add(-2 * time.Second)
+	arrivals := []time.Duration{-500, 100, 100, 100, 2100, 2100, 2400, 3100, 3200}
+	i := 0
+	dut := NmeaSync{
+		Reader:  strings.NewReader(recorded),
+		Latency: 100 * time.Millisecond,
+		Samples: 3,
+		Now: func() time.Time {
+			result := local.Add(arrivals[i] * time.Millisecond)
+			i++
+			return result
+		},
+	}
+	offset, err := dut.GetOffset()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2*time.Second, offset)
+	assert.Equal(t, "gps", dut.SourceKind())
+
+	_, err = dut.GetOffset() //End of recording
+	assert.NotEqual(t, nil, err)
+}
+
+func TestNmeaSyncBuffered(t *testing.T) {
+	recorded := strings.Join([]string{
+		testNmea("GNRMC,101500.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"), //Queued before call
+		testNmea("GNRMC,101501.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"), //Queued before call
+		testNmea("GNRMC,101502.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"), //Queued before call
+		testNmea("GNRMC,101506.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"),
+		testNmea("GNRMC,101507.00,A,6027.000,N,02500.000,E,0.0,0.0,200722,,,A"),
+	}, "\r\n")
+
+	//Local clock is 2s behind. Call is made at 10:15:05.5 GPS time. Queued sentences are read immediately
+	local := time.Date(2022, 7, 20, 10, 15, 5, 500*1000*1000, time.UTC).Add(-2 * time.Second)
+	arrivals := []time.Duration{0, 1, 2, 3, 600, 1600}
+	i := 0
+	dut := NmeaSync{
+		Reader:  strings.NewReader(recorded),
+		Latency: 100 * time.Millisecond,
+		Samples: 2,
+		Now: func() time.Time {
+			result := local.Add(arrivals[i] * time.Millisecond)
+			i++
+			return result
+		},
+	}
+	offset, err := dut.GetOffset()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2*time.Second, offset)
+
+	dut = NmeaSync{Reader: strings.NewReader(recorded), Samples: 2, ReadGap: -1}
+	offset, err = dut.GetOffset() //Recorded file, all sentences used
+	assert.Equal(t, nil, err)
+	assert.Less(t, offset, -time.Hour)
+}
@@ -2,6 +2,7 @@ package timesync
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,6 +14,12 @@ import (
 type NtpSync struct {
 	Servers      []string
 	QueryTimeout time.Duration
+
+	//Multi-sample mode, used by GetOffset if SamplesPerServer is more than 1
+	SamplesPerServer int
+	KeepSamples      int           //How many lowest delay samples are kept per server. Default 1
+	SampleInterval   time.Duration //Wait between samples to same server
+	OutlierLimit     time.Duration //Server is rejected if offset is further from median than this plus its error estimate. Default NTP_DEFAULTOUTLIERLIMIT
 }
 
 func GetDefaultFinnishNTP() NtpSync {
@@ -33,6 +40,47 @@ func (p *NtpSync) pickServerList() []string {
 }
 
 func (p *NtpSync) GetOffset() (time.Duration, error) {
+	sample, err := p.GetSample()
+	return sample.Offset, err
+}
+
+func (p *NtpSync) SourceKind() string {
+	return "ntp"
+}
+
+//sampleFromResponse creates SyncSample from NTP response measured at local time t
+func sampleFromResponse(server string, resp *ntp.Response, t time.Time) SyncSample {
+	return SyncSample{
+		Offset:        resp.ClockOffset,
+		ErrorEstimate: resp.RTT/2 + resp.RootDistance,
+		Source:        "ntp",
+		Server:        server,
+		RTT:           resp.RTT,
+		Stratum:       resp.Stratum,
+		Leap:          uint8(resp.Leap),
+		Precision:     resp.Precision,
+		Time:          t,
+	}
+}
+
+//GetSample returns offset of first valid server. In multi-sample mode (SamplesPerServer more than 1) combined
+//offset and error estimate are returned with metadata of best accepted server
+func (p *NtpSync) GetSample() (SyncSample, error) {
+	if 1 < p.SamplesPerServer {
+		est, err := p.GetEstimate()
+		if err != nil {
+			return SyncSample{}, err
+		}
+		result := SyncSample{}
+		for _, server := range est.Servers {
+			if !server.Rejected && (len(result.Server) == 0 || server.ErrorEstimate < result.ErrorEstimate) {
+				result = server.sample
+			}
+		}
+		result.Offset = est.Offset
+		result.ErrorEstimate = est.ErrorEstimate
+		return result, nil
+	}
 	if p.QueryTimeout < time.Millisecond*100 {
 		p.QueryTimeout = time.Second * 30
 	}
@@ -41,16 +89,162 @@ func (p *NtpSync) GetOffset() (time.Duration, error) {
 	lst := p.pickServerList()
 	for i, name := range lst {
 		resp, err := ntp.QueryWithOptions(name, ntp.QueryOptions{Timeout: p.QueryTimeout})
+		tMeasured := time.Now()
 		if err != nil {
 			errList = append(errList, fmt.Sprintf("server:%v name:%s error: %s", i, name, err))
 			continue
 		}
 		errvalid := resp.Validate()
 		if errvalid == nil {
-			return resp.ClockOffset, nil
+			return sampleFromResponse(name, resp, tMeasured), nil
 		}
 		errList = append(errList, fmt.Sprintf("server:%v name:%s invalid: %s", i, name, errvalid))
 	}
 
-	return 0, fmt.Errorf("failed NTP servers [%s]", strings.Join(errList, ","))
+	return SyncSample{}, fmt.Errorf("failed NTP servers [%s]", strings.Join(errList, ","))
+}
+
+const NTP_DEFAULTOUTLIERLIMIT = 100 * time.Millisecond
+
+//NtpServerEstimate is result from one server in multi-sample mode
+type NtpServerEstimate struct {
+	Server        string
+	Offset        time.Duration //Median of kept samples
+	Delay         time.Duration //Lowest round trip delay
+	ErrorEstimate time.Duration //Half of delay + root distance
+	Samples       int           //Valid samples
+	Rejected      bool          //Outlier compared to other servers
+
+	sample SyncSample //Lowest delay sample
+}
+
+//NtpEstimate is combined result of multi-sample mode
+type NtpEstimate struct {
+	Offset        time.Duration
+	ErrorEstimate time.Duration
+	Servers       []NtpServerEstimate
+}
+
+//sampleServer queries server SamplesPerServer times and picks lowest delay samples
+func (p *NtpSync) sampleServer(name string) (NtpServerEstimate, error) {
+	result := NtpServerEstimate{Server: name}
+	responses := []*ntp.Response{}
+	measured := map[*ntp.Response]time.Time{}
+	errList := []string{}
+	for i := 0; i < p.SamplesPerServer; i++ {
+		if 0 < i && 0 < p.SampleInterval {
+			time.Sleep(p.SampleInterval)
+		}
+		resp, err := ntp.QueryWithOptions(name, ntp.QueryOptions{Timeout: p.QueryTimeout})
+		if err != nil {
+			errList = append(errList, err.Error())
+			continue
+		}
+		measured[resp] = time.Now()
+		if resp.IsKissOfDeath() {
+			return result, fmt.Errorf("kiss of death %s", resp.KissCode)
+		}
+		errvalid := resp.Validate()
+		if errvalid != nil {
+			errList = append(errList, errvalid.Error())
+			continue
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) == 0 {
+		return result, fmt.Errorf("no valid samples [%s]", strings.Join(errList, ","))
+	}
+	result.Samples = len(responses)
+
+	sort.Slice(responses, func(i, j int) bool { return responses[i].RTT < responses[j].RTT })
+	keep := p.KeepSamples
+	if keep < 1 {
+		keep = 1
+	}
+	if len(responses) < keep {
+		keep = len(responses)
+	}
+	offsets := make([]time.Duration, keep)
+	for i := range offsets {
+		offsets[i] = responses[i].ClockOffset
+	}
+	result.Offset = medianDuration(offsets)
+	result.Delay = responses[0].RTT
+	result.ErrorEstimate = responses[0].RTT/2 + responses[0].RootDistance
+	result.sample = sampleFromResponse(name, responses[0], measured[responses[0]])
+	return result, nil
+}
+
+func medianDuration(arr []time.Duration) time.Duration {
+	sorted := make([]time.Duration, len(arr))
+	copy(sorted, arr)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+//GetEstimate takes SamplesPerServer samples from all servers, rejects outlier servers and combines rest
+func (p *NtpSync) GetEstimate() (NtpEstimate, error) {
+	if p.QueryTimeout < time.Millisecond*100 {
+		p.QueryTimeout = time.Second * 30
+	}
+	if p.SamplesPerServer < 1 {
+		p.SamplesPerServer = 1
+	}
+	outlierLimit := p.OutlierLimit
+	if outlierLimit <= 0 {
+		outlierLimit = NTP_DEFAULTOUTLIERLIMIT
+	}
+
+	result := NtpEstimate{}
+	errList := []string{}
+	offsets := []time.Duration{}
+	for i, name := range p.pickServerList() {
+		est, err := p.sampleServer(name)
+		if err != nil {
+			errList = append(errList, fmt.Sprintf("server:%v name:%s error: %s", i, name, err))
+			continue
+		}
+		result.Servers = append(result.Servers, est)
+		offsets = append(offsets, est.Offset)
+	}
+	if len(result.Servers) == 0 {
+		return result, fmt.Errorf("failed NTP servers [%s]", strings.Join(errList, ","))
+	}
+
+	median := medianDuration(offsets)
+	var sum time.Duration
+	accepted := 0
+	for i, est := range result.Servers {
+		if outlierLimit+est.ErrorEstimate < absDuration(est.Offset-median) {
+			result.Servers[i].Rejected = true
+			continue
+		}
+		sum += est.Offset
+		accepted++
+	}
+	if accepted == 0 {
+		return result, fmt.Errorf("no agreeing servers, offsets %v differ from median %v", offsets, median)
+	}
+	result.Offset = sum / time.Duration(accepted)
+	for _, est := range result.Servers {
+		if est.Rejected {
+			continue
+		}
+		e := est.ErrorEstimate + absDuration(est.Offset-result.Offset)
+		if result.ErrorEstimate < e {
+			result.ErrorEstimate = e
+		}
+	}
+	return result, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
 }
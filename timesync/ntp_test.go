@@ -0,0 +1,104 @@
+package timesync
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _ SampleSync = &NtpSync{}
+var _ SampleSync = &NtpPool{}
+var _ SampleSync = &HttpDateSync{}
+var _ SampleSync = &NmeaSync{}
+
+//startTestNtpServer starts local NTP stand-in that is offset from local clock. Every second query is delayed by slowDelay
+func startTestNtpServer(t *testing.T, offset time.Duration, slowDelay time.Duration) string {
+	conn, errListen := net.ListenPacket("udp", "127.0.0.1:0")
+	if errListen != nil {
+		t.Fatal(errListen)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		count := 0
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			count++
+			if count%2 == 0 {
+				time.Sleep(slowDelay)
+			}
+			now := time.Now().Add(offset)
+			resp := make([]byte, 48)
+			resp[0] = 0<<6 | 4<<3 | 4 //No leap warning, version 4, server
+			resp[1] = 2               //Stratum
+			resp[3] = 0xEC            //Precision -20
+			copy(resp[12:16], []byte("TEST"))
+			binary.BigEndian.PutUint64(resp[16:24], toNtpTimestamp(now.Add(-time.Minute)))
+			copy(resp[24:32], buf[40:48]) //Origin is client transmit
+			binary.BigEndian.PutUint64(resp[32:40], toNtpTimestamp(now))
+			binary.BigEndian.PutUint64(resp[40:48], toNtpTimestamp(now))
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNtpEstimate(t *testing.T) {
+	dut := NtpSync{
+		Servers: []string{
+			startTestNtpServer(t, 2*time.Second, 200*time.Millisecond),
+			startTestNtpServer(t, 2*time.Second, 0),
+			startTestNtpServer(t, 10*time.Second, 0), //Falseticker
+		},
+		QueryTimeout:     time.Second,
+		SamplesPerServer: 4,
+	}
+	est, err := dut.GetEstimate()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(est.Servers))
+	assert.InDelta(t, float64(2*time.Second), float64(est.Offset), float64(20*time.Millisecond))
+	assert.Less(t, est.ErrorEstimate, 50*time.Millisecond)
+	for _, server := range est.Servers {
+		assert.Equal(t, 4, server.Samples)
+		assert.Less(t, server.Delay, 100*time.Millisecond) //Lowest delay sample is used
+		assert.Equal(t, 10*time.Second < server.Offset+time.Second, server.Rejected, server.Server)
+	}
+
+	offset, errOffset := dut.GetOffset()
+	assert.Equal(t, nil, errOffset)
+	assert.InDelta(t, float64(2*time.Second), float64(offset), float64(20*time.Millisecond))
+
+	dut.Servers = []string{"127.0.0.1:1"}
+	dut.QueryTimeout = 200 * time.Millisecond
+	_, err = dut.GetEstimate()
+	assert.NotEqual(t, nil, err)
+}
+
+func TestNtpEstimateNoAgreement(t *testing.T) {
+	dut := NtpSync{
+		Servers: []string{
+			startTestNtpServer(t, 2*time.Second, 0),
+			startTestNtpServer(t, 3*time.Second, 0),
+		},
+		QueryTimeout:     time.Second,
+		SamplesPerServer: 2,
+	}
+	est, err := dut.GetEstimate()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 2, len(est.Servers))
+	for _, server := range est.Servers {
+		assert.Equal(t, true, server.Rejected, server.Server)
+	}
+
+	_, errOffset := dut.GetOffset() //Multi-sample mode uses estimate
+	assert.NotEqual(t, nil, errOffset)
+}
@@ -0,0 +1,220 @@
+package timesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/ntp"
+)
+
+const (
+	NTPPOOL_DEFAULTQUERYTIMEOUT = 5 * time.Second
+	NTPPOOL_DEFAULTMINBACKOFF   = time.Minute
+	NTPPOOL_DEFAULTMAXBACKOFF   = time.Hour
+)
+
+type NtpPoolServerConf struct {
+	Host string `json:"host"` //Name, IPv4 or IPv6 address without brackets
+	Port int    `json:"port,omitempty"`
+}
+
+//NtpPoolConf is loaded from json file. Durations are milliseconds
+type NtpPoolConf struct {
+	Servers        []NtpPoolServerConf `json:"servers"`
+	QueryTimeoutMs int                 `json:"queryTimeoutMs,omitempty"`
+	MinBackoffMs   int                 `json:"minBackoffMs,omitempty"` //Backoff after first failure, doubles after each failure
+	MaxBackoffMs   int                 `json:"maxBackoffMs,omitempty"` //Also used after Kiss-o'-Death
+}
+
+//NtpServerState is health of one server
+type NtpServerState struct {
+	Address             string
+	Successes           int
+	Failures            int
+	ConsecutiveFailures int
+	Delay               time.Duration //Round trip delay of latest successful query
+	KissCode            string        //Latest Kiss-o'-Death code
+	LastError           string
+	LastSuccess         time.Time
+	BackoffUntil        time.Time
+}
+
+//NtpPool picks server by past health and backs off from failing servers
+type NtpPool struct {
+	Now func() time.Time //For testing, default time.Now
+
+	queryTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	servers      []NtpServerState
+	lock         sync.Mutex
+}
+
+//LoadNtpPoolConf reads json configuration
+func LoadNtpPoolConf(filename string) (NtpPoolConf, error) {
+	result := NtpPoolConf{}
+	byt, errRead := os.ReadFile(filename)
+	if errRead != nil {
+		return result, errRead
+	}
+	errParse := json.Unmarshal(byt, &result)
+	if errParse != nil {
+		return result, fmt.Errorf("invalid ntp pool configuration %s err=%v", filename, errParse)
+	}
+	return result, nil
+}
+
+func (p *NtpPoolConf) CheckErrors() error {
+	if len(p.Servers) == 0 {
+		return fmt.Errorf("no servers")
+	}
+	for i, server := range p.Servers {
+		if len(server.Host) == 0 {
+			return fmt.Errorf("server %v host missing", i)
+		}
+		if server.Port < 0 || 65535 < server.Port {
+			return fmt.Errorf("server %v invalid port %v", i, server.Port)
+		}
+	}
+	if p.QueryTimeoutMs < 0 || p.MinBackoffMs < 0 || p.MaxBackoffMs < 0 {
+		return fmt.Errorf("negative durations not allowed")
+	}
+	return nil
+}
+
+//durationMs converts configuration value, zero gives default
+func durationMs(ms int, def time.Duration) time.Duration {
+	if ms == 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (p *NtpPoolConf) InitNtpPool() (*NtpPool, error) {
+	errCheck := p.CheckErrors()
+	if errCheck != nil {
+		return nil, errCheck
+	}
+	result := NtpPool{
+		Now:          time.Now,
+		queryTimeout: durationMs(p.QueryTimeoutMs, NTPPOOL_DEFAULTQUERYTIMEOUT),
+		minBackoff:   durationMs(p.MinBackoffMs, NTPPOOL_DEFAULTMINBACKOFF),
+		maxBackoff:   durationMs(p.MaxBackoffMs, NTPPOOL_DEFAULTMAXBACKOFF),
+		servers:      make([]NtpServerState, len(p.Servers)),
+	}
+	for i, server := range p.Servers {
+		port := server.Port
+		if port == 0 {
+			port = 123
+		}
+		result.servers[i].Address = net.JoinHostPort(server.Host, strconv.Itoa(port))
+	}
+	return &result, nil
+}
+
+//State returns copy of server states for diagnostics
+func (p *NtpPool) State() []NtpServerState {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]NtpServerState{}, p.servers...)
+}
+
+//candidates are servers not backing off. Best first: less consecutive failures, better success ratio, smaller delay
+func (p *NtpPool) candidates(now time.Time) []int {
+	result := []int{}
+	for i, server := range p.servers {
+		if !now.Before(server.BackoffUntil) {
+			result = append(result, i)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a := p.servers[result[i]]
+		b := p.servers[result[j]]
+		if a.ConsecutiveFailures != b.ConsecutiveFailures {
+			return a.ConsecutiveFailures < b.ConsecutiveFailures
+		}
+		//a.Successes/(a total) > b.Successes/(b total) without division
+		ratioA := a.Successes * (b.Successes + b.Failures + 1)
+		ratioB := b.Successes * (a.Successes + a.Failures + 1)
+		if ratioA != ratioB {
+			return ratioA > ratioB
+		}
+		return a.Delay < b.Delay
+	})
+	return result
+}
+
+func (p *NtpPool) fail(i int, now time.Time, backoff time.Duration, errMsg string) {
+	server := &p.servers[i]
+	server.Failures++
+	server.ConsecutiveFailures++
+	server.LastError = errMsg
+	if backoff == 0 {
+		backoff = p.maxBackoff
+		shift := server.ConsecutiveFailures - 1
+		if shift < bits.Len64(uint64(p.maxBackoff/p.minBackoff)) && p.minBackoff<<shift < p.maxBackoff { //Checking shift first, large shift overflows
+			backoff = p.minBackoff << shift
+		}
+	}
+	server.BackoffUntil = now.Add(backoff)
+}
+
+//GetOffset queries servers in order of health until one gives valid response
+func (p *NtpPool) GetOffset() (time.Duration, error) {
+	sample, err := p.GetSample()
+	return sample.Offset, err
+}
+
+//GetSample is GetOffset with metadata
+func (p *NtpPool) GetSample() (SyncSample, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.Now()
+	candidates := p.candidates(now)
+	if len(candidates) == 0 {
+		return SyncSample{}, fmt.Errorf("all NTP servers are backing off")
+	}
+	errList := []string{}
+	for _, i := range candidates {
+		address := p.servers[i].Address
+		resp, err := ntp.QueryWithOptions(address, ntp.QueryOptions{Timeout: p.queryTimeout})
+		tMeasured := time.Now()
+		if err != nil {
+			p.fail(i, now, 0, err.Error())
+			errList = append(errList, fmt.Sprintf("%s error: %s", address, err))
+			continue
+		}
+		if resp.IsKissOfDeath() {
+			p.servers[i].KissCode = resp.KissCode
+			p.fail(i, now, p.maxBackoff, "kiss of death "+resp.KissCode)
+			errList = append(errList, fmt.Sprintf("%s kiss of death %s", address, resp.KissCode))
+			continue
+		}
+		errValid := resp.Validate()
+		if errValid != nil {
+			p.fail(i, now, 0, errValid.Error())
+			errList = append(errList, fmt.Sprintf("%s invalid: %s", address, errValid))
+			continue
+		}
+		server := &p.servers[i]
+		server.Successes++
+		server.ConsecutiveFailures = 0
+		server.Delay = resp.RTT
+		server.LastSuccess = now
+		server.BackoffUntil = time.Time{}
+		return sampleFromResponse(address, resp, tMeasured), nil
+	}
+	return SyncSample{}, fmt.Errorf("failed NTP servers [%s]", strings.Join(errList, ","))
+}
+
+func (p *NtpPool) SourceKind() string {
+	return "ntp"
+}
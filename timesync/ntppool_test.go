@@ -0,0 +1,97 @@
+package timesync
+
+import (
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//startTestResponder serves clock on local port
+func startTestResponder(t *testing.T, responder *NtpResponder) (net.PacketConn, int) {
+	conn, errListen := net.ListenPacket("udp", "127.0.0.1:0")
+	if errListen != nil {
+		t.Fatal(errListen)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go responder.Serve(conn)
+	return conn, conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestNtpPoolConf(t *testing.T) {
+	fname := path.Join(t.TempDir(), "ntppool.json")
+	os.WriteFile(fname, []byte(`{"servers":[{"host":"fi.pool.ntp.org"},{"host":"fe80::1","port":1123}],"queryTimeoutMs":500}`), 0666)
+	conf, errLoad := LoadNtpPoolConf(fname)
+	assert.Equal(t, nil, errLoad)
+	pool, errInit := conf.InitNtpPool()
+	assert.Equal(t, nil, errInit)
+	state := pool.State()
+	assert.Equal(t, "fi.pool.ntp.org:123", state[0].Address)
+	assert.Equal(t, "[fe80::1]:1123", state[1].Address)
+
+	conf.Servers = nil
+	_, errInit = conf.InitNtpPool()
+	assert.NotEqual(t, nil, errInit)
+}
+
+func TestNtpPool(t *testing.T) {
+	dead, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	deadPort := dead.LocalAddr().(*net.UDPAddr).Port
+	dead.Close()
+	_, kodPort := startTestResponder(t, &NtpResponder{Clock: &testServerClock{stratum: 0, synced: true}, RefId: [4]byte{'R', 'A', 'T', 'E'}})
+	goodConn, goodPort := startTestResponder(t, &NtpResponder{Clock: &testServerClock{offset: 3 * time.Second, stratum: 2, synced: true}})
+
+	conf := NtpPoolConf{
+		Servers:        []NtpPoolServerConf{{Host: "127.0.0.1", Port: deadPort}, {Host: "127.0.0.1", Port: kodPort}, {Host: "127.0.0.1", Port: goodPort}},
+		QueryTimeoutMs: 500,
+	}
+	dut, errInit := conf.InitNtpPool()
+	assert.Equal(t, nil, errInit)
+	tNow := time.Date(2022, 7, 20, 16, 27, 7, 0, time.UTC)
+	dut.Now = func() time.Time { return tNow }
+
+	offset, err := dut.GetOffset()
+	assert.Equal(t, nil, err)
+	assert.InDelta(t, float64(3*time.Second), float64(offset), float64(10*time.Millisecond))
+	state := dut.State()
+	assert.Equal(t, 1, state[0].Failures)
+	assert.Equal(t, tNow.Add(NTPPOOL_DEFAULTMINBACKOFF), state[0].BackoffUntil)
+	assert.Equal(t, "RATE", state[1].KissCode)
+	assert.Equal(t, tNow.Add(NTPPOOL_DEFAULTMAXBACKOFF), state[1].BackoffUntil)
+	assert.Equal(t, 1, state[2].Successes)
+
+	//Healthy server is picked first even after backoff of dead server is over
+	tNow = tNow.Add(2 * time.Minute)
+	_, err = dut.GetOffset()
+	assert.Equal(t, nil, err)
+	state = dut.State()
+	assert.Equal(t, 1, state[0].Failures)
+	assert.Equal(t, 2, state[2].Successes)
+
+	//Good server dies, dead server backs off longer
+	goodConn.Close()
+	_, err = dut.GetOffset()
+	assert.NotEqual(t, nil, err)
+	state = dut.State()
+	assert.Equal(t, 2, state[0].ConsecutiveFailures)
+	assert.Equal(t, tNow.Add(2*NTPPOOL_DEFAULTMINBACKOFF), state[0].BackoffUntil)
+	assert.Equal(t, 1, state[2].Failures)
+
+	_, err = dut.GetOffset()
+	assert.Equal(t, "all NTP servers are backing off", err.Error())
+	assert.Equal(t, "127.0.0.1:"+strconv.Itoa(goodPort), state[2].Address)
+
+	//Long outage stays on max backoff
+	for failures := 3; failures < 70; failures++ {
+		dut.fail(0, tNow, 0, "timeout")
+		expected := NTPPOOL_DEFAULTMAXBACKOFF
+		if failures < 7 {
+			expected = NTPPOOL_DEFAULTMINBACKOFF << (failures - 1)
+		}
+		assert.Equal(t, tNow.Add(expected), dut.State()[0].BackoffUntil, failures)
+	}
+}
@@ -0,0 +1,145 @@
+package timesync
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	NTP_PACKETSIZE      = 48
+	NTP_STRATUMUNSYNCED = 16
+	ntpEpochOffset      = 2208988800 //Seconds from 1900 to 1970
+	ntpModeClient       = 3
+	ntpModeServer       = 4
+	ntpLeapNoWarning    = 0
+	ntpLeapNotInSync    = 3
+)
+
+//ServerClock gives time that is served to peers. TimeGopher implements this
+type ServerClock interface {
+	ServerTime() (time.Time, uint8, bool) //time, stratum and is time synced
+}
+
+//ServerSyncInfo is optional interface of ServerClock. TimeGopher implements this
+type ServerSyncInfo interface {
+	ServerSync() (time.Time, time.Duration) //reference time (latest sync) and error estimate
+}
+
+//NtpResponder is minimal SNTP server for serving time to local peers
+type NtpResponder struct {
+	Clock    ServerClock //If implements ServerSyncInfo, reference time and root dispersion are served. Otherwise receive time and 0
+	Lock     sync.Locker //Optional, locked while reading Clock
+	RefId    [4]byte     //Reference id. Default LOCL
+	ErrorLog func(error) //Optional, called when response can not be sent. Default log.Printf
+}
+
+func (p *NtpResponder) now() (time.Time, uint8, bool) {
+	if p.Lock != nil {
+		p.Lock.Lock()
+		defer p.Lock.Unlock()
+	}
+	return p.Clock.ServerTime()
+}
+
+//syncInfo is reference time and error estimate of Clock. ok false if Clock does not implement ServerSyncInfo
+func (p *NtpResponder) syncInfo() (time.Time, time.Duration, bool) {
+	info, ok := p.Clock.(ServerSyncInfo)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	if p.Lock != nil {
+		p.Lock.Lock()
+		defer p.Lock.Unlock()
+	}
+	ref, errorEstimate := info.ServerSync()
+	return ref, errorEstimate, true
+}
+
+//toNtpShort converts duration to NTP short format (16.16 seconds)
+func toNtpShort(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	if time.Duration(0xFFFF)*time.Second < d {
+		return 0xFFFFFFFF
+	}
+	return uint32(uint64(d) << 16 / uint64(time.Second))
+}
+
+func toNtpTimestamp(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1000000000
+	return sec<<32 | frac
+}
+
+//Response creates response packet for request received at recvTime (from Clock). Error if request is not client request
+func (p *NtpResponder) Response(req []byte, recvTime time.Time) ([]byte, error) {
+	if len(req) < NTP_PACKETSIZE {
+		return nil, fmt.Errorf("too short packet %v bytes", len(req))
+	}
+	version := req[0] >> 3 & 7
+	if req[0]&7 != ntpModeClient || version < 1 || 4 < version {
+		return nil, fmt.Errorf("not client request")
+	}
+	transmitTime, stratum, synced := p.now()
+	leap := byte(ntpLeapNoWarning)
+	if !synced {
+		leap = ntpLeapNotInSync
+		stratum = NTP_STRATUMUNSYNCED
+	}
+	refId := p.RefId
+	if refId == [4]byte{} {
+		refId = [4]byte{'L', 'O', 'C', 'L'}
+	}
+	refTime, errorEstimate, hasInfo := p.syncInfo()
+	if !hasInfo {
+		refTime = recvTime
+	}
+
+	resp := make([]byte, NTP_PACKETSIZE)
+	resp[0] = leap<<6 | version<<3 | ntpModeServer
+	resp[1] = stratum
+	resp[2] = req[2] //Poll
+	resp[3] = 0xEC   //Precision -20, about microsecond
+	binary.BigEndian.PutUint32(resp[8:12], toNtpShort(errorEstimate))
+	copy(resp[12:16], refId[:])
+	if !refTime.IsZero() {
+		binary.BigEndian.PutUint64(resp[16:24], toNtpTimestamp(refTime))
+	}
+	copy(resp[24:32], req[40:48]) //Origin is transmit time of client
+	binary.BigEndian.PutUint64(resp[32:40], toNtpTimestamp(recvTime))
+	binary.BigEndian.PutUint64(resp[40:48], toNtpTimestamp(transmitTime))
+	return resp, nil
+}
+
+//Serve answers requests until conn is closed. Failed responses are reported to ErrorLog
+func (p *NtpResponder) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, errRead := conn.ReadFrom(buf)
+		if errRead != nil {
+			return errRead
+		}
+		recvTime, _, _ := p.now()
+		resp, errResp := p.Response(buf[:n], recvTime)
+		if errResp != nil {
+			continue //Ignore invalid packets
+		}
+		_, errWrite := conn.WriteTo(resp, addr)
+		if errWrite != nil {
+			p.logError(fmt.Errorf("sending NTP response to %v failed err=%v", addr, errWrite))
+		}
+	}
+}
+
+func (p *NtpResponder) logError(err error) {
+	if p.ErrorLog == nil {
+		log.Printf("%v", err)
+		return
+	}
+	p.ErrorLog(err)
+}
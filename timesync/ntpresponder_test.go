@@ -0,0 +1,107 @@
+package timesync
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/stretchr/testify/assert"
+)
+
+type testServerClock struct {
+	offset  time.Duration
+	stratum uint8
+	synced  bool
+}
+
+func (p *testServerClock) ServerTime() (time.Time, uint8, bool) {
+	return time.Now().Add(p.offset), p.stratum, p.synced
+}
+
+type testSyncedServerClock struct {
+	testServerClock
+	ref           time.Time
+	errorEstimate time.Duration
+}
+
+func (p *testSyncedServerClock) ServerSync() (time.Time, time.Duration) {
+	return p.ref, p.errorEstimate
+}
+
+//testFailingConn fails first writes
+type testFailingConn struct {
+	net.PacketConn
+	failures int
+}
+
+func (p *testFailingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if 0 < p.failures {
+		p.failures--
+		return 0, fmt.Errorf("test write failure")
+	}
+	return p.PacketConn.WriteTo(b, addr)
+}
+
+func TestNtpResponder(t *testing.T) {
+	conn, errListen := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, errListen)
+	clock := testServerClock{offset: 5 * time.Second, stratum: 2, synced: true}
+	var mu sync.Mutex
+	dut := NtpResponder{Clock: &clock, Lock: &mu}
+	go dut.Serve(conn)
+	defer conn.Close()
+
+	resp, errQuery := ntp.QueryWithOptions(conn.LocalAddr().String(), ntp.QueryOptions{Timeout: time.Second})
+	assert.Equal(t, nil, errQuery)
+	assert.Equal(t, nil, resp.Validate())
+	assert.Equal(t, uint8(2), resp.Stratum)
+	assert.InDelta(t, float64(5*time.Second), float64(resp.ClockOffset), float64(10*time.Millisecond))
+
+	offset, errOffset := (&NtpSync{Servers: []string{conn.LocalAddr().String()}, QueryTimeout: time.Second, SamplesPerServer: 3}).GetOffset()
+	assert.Equal(t, nil, errOffset)
+	assert.InDelta(t, float64(5*time.Second), float64(offset), float64(10*time.Millisecond))
+
+	sample, errSample := (&NtpSync{Servers: []string{conn.LocalAddr().String()}, QueryTimeout: time.Second}).GetSample()
+	assert.Equal(t, nil, errSample)
+	assert.Equal(t, "ntp", sample.Source)
+	assert.Equal(t, conn.LocalAddr().String(), sample.Server)
+	assert.Equal(t, uint8(2), sample.Stratum)
+	assert.Less(t, time.Since(sample.Time), time.Second)
+
+	//Own time is not synced
+	mu.Lock()
+	clock.synced = false
+	mu.Unlock()
+	resp, errQuery = ntp.QueryWithOptions(conn.LocalAddr().String(), ntp.QueryOptions{Timeout: time.Second})
+	assert.Equal(t, nil, errQuery)
+	assert.Equal(t, ntp.LeapIndicator(ntp.LeapNotInSync), resp.Leap)
+	assert.NotEqual(t, nil, resp.Validate())
+
+	_, errResp := dut.Response(make([]byte, NTP_PACKETSIZE), time.Now())
+	assert.NotEqual(t, nil, errResp) //Mode 0 is not client
+}
+
+func TestNtpResponderSyncInfo(t *testing.T) {
+	conn, errListen := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Equal(t, nil, errListen)
+	defer conn.Close()
+	ref := time.Now().Add(-time.Minute)
+	clock := testSyncedServerClock{testServerClock: testServerClock{stratum: 2, synced: true}, ref: ref, errorEstimate: 250 * time.Millisecond}
+	errs := make(chan error, 1)
+	dut := NtpResponder{Clock: &clock, ErrorLog: func(err error) { errs <- err }}
+	go dut.Serve(&testFailingConn{PacketConn: conn, failures: 1})
+
+	//First response is not sent, serving continues
+	_, errQuery := ntp.QueryWithOptions(conn.LocalAddr().String(), ntp.QueryOptions{Timeout: 200 * time.Millisecond})
+	assert.NotEqual(t, nil, errQuery)
+	assert.NotEqual(t, nil, <-errs)
+
+	resp, errQuery := ntp.QueryWithOptions(conn.LocalAddr().String(), ntp.QueryOptions{Timeout: time.Second})
+	assert.Equal(t, nil, errQuery)
+	assert.Equal(t, nil, resp.Validate())
+	assert.InDelta(t, float64(ref.UnixNano()), float64(resp.ReferenceTime.UnixNano()), float64(time.Microsecond))
+	assert.InDelta(t, float64(250*time.Millisecond), float64(resp.RootDispersion), float64(time.Millisecond))
+}
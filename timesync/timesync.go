@@ -9,3 +9,32 @@ type TimeSync interface {
 	//Get difference to time now
 	GetOffset() (time.Duration, error)
 }
+
+//SyncSample is measurement with metadata. Implements timegopher.MeasurementSample, convert with timegopher.MeasurementFromSample
+type SyncSample struct {
+	Offset        time.Duration //Correct time - local clock
+	ErrorEstimate time.Duration //0 if not known
+	Source        string        //Like "ntp", "gps" or "http"
+	Server        string        //Server or device that answered
+	RTT           time.Duration
+	Stratum       uint8
+	Leap          uint8 //Leap indicator, 3 is not synchronized
+	Precision     time.Duration
+	Time          time.Time //Local clock when measured, have monotonic reading
+}
+
+func (p SyncSample) SampleOffset() time.Duration        { return p.Offset }
+func (p SyncSample) SampleErrorEstimate() time.Duration { return p.ErrorEstimate }
+func (p SyncSample) SampleSource() string               { return p.Source }
+func (p SyncSample) SampleServer() string               { return p.Server }
+func (p SyncSample) SampleRTT() time.Duration           { return p.RTT }
+func (p SyncSample) SampleStratum() uint8               { return p.Stratum }
+func (p SyncSample) SampleLeap() uint8                  { return p.Leap }
+func (p SyncSample) SamplePrecision() time.Duration     { return p.Precision }
+func (p SyncSample) SampleTime() time.Time              { return p.Time }
+
+//SampleSync is TimeSync that can give SyncSample
+type SampleSync interface {
+	TimeSync
+	GetSample() (SyncSample, error)
+}
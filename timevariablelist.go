@@ -38,18 +38,56 @@ func (e TimeVariableList) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
-//SolveEpoch picks TimeVariable entry at defined boot number just before or at uptime and uses that for solving epoch
+//checkAppend checks that t can be appended to end of list. Entries must be cumulative
+func (p *TimeVariableList) checkAppend(t TimeVariable) error {
+	n := p.Len()
+	if 0 < n && !(*p)[n-1].Before(t) { //If there are points, check that new variable is t is really after. Not before or same
+		return fmt.Errorf("inserted time t=%#v is before latest entry %#v", t, (*p)[n-1])
+	}
+	return nil
+}
+
+//latestN gives n latest entries (or less if not available)
+func (p TimeVariableList) latestN(n int) TimeVariableList {
+	if len(p) < n {
+		return p
+	}
+	return p[len(p)-n:]
+}
+
+//firstN gives n first entries (or less if not available)
+func (p TimeVariableList) firstN(n int) TimeVariableList {
+	if len(p) < n {
+		return p
+	}
+	return p[0:n]
+}
+
+//SolveEpoch picks TimeVariable entry at defined boot number just before or at uptime and uses that for solving epoch.
+//Boot does not need to be latest: on earlier boot, uptime after last entry is extrapolated from last entry of that boot
+//and uptime before first entry uses latest entry of that boot. Error only if there are no entries on boot
 func (p *TimeVariableList) SolveEpoch(bootNumber int32, uptime NsUptime) (NsEpoch, error) {
+	point, errPoint := p.solvePoint(bootNumber, uptime)
+	if errPoint != nil {
+		return 0, errPoint
+	}
+	return point.SolveEpoch(bootNumber, uptime)
+}
+
+//solvePoint picks entry that SolveEpoch uses as reference
+func (p *TimeVariableList) solvePoint(bootNumber int32, uptime NsUptime) (TimeVariable, error) {
 	if len(*p) == 0 {
-		return 0, fmt.Errorf("no data in TimeVariableList, solving bootNumber=%v, uptime=%v", bootNumber, uptime)
+		return TimeVariable{}, fmt.Errorf("no data in TimeVariableList, solving bootNumber=%v, uptime=%v", bootNumber, uptime)
 	}
 	//Get "just before" point
 	index := -1
+	lastInBoot := -1
 	for i, v := range *p { //TODO optimized search later
 		if bootNumber < v.BootNumber {
-			return 0, fmt.Errorf("not found point for boot %v", bootNumber)
+			break //Sorted, rest of entries are on later boots
 		}
 		if v.BootNumber == bootNumber {
+			lastInBoot = i
 			if v.Uptime <= uptime {
 				index = i
 			}
@@ -57,12 +95,66 @@ func (p *TimeVariableList) SolveEpoch(bootNumber int32, uptime NsUptime) (NsEpoc
 	}
 
 	if index < 0 {
-		if (*p)[p.Len()-1].BootNumber == bootNumber {
-			return (*p)[p.Len()-1].SolveEpoch(bootNumber, uptime)
+		if 0 <= lastInBoot { //Uptime is before first point on boot, use latest on that boot
+			return (*p)[lastInBoot], nil
 		}
-		return 0, fmt.Errorf("points not found boot %v", bootNumber)
+		return TimeVariable{}, fmt.Errorf("points not found boot %v", bootNumber)
 	}
-	return (*p)[index].SolveEpoch(bootNumber, uptime)
+	return (*p)[index], nil
+}
+
+//Compact picks minimal set of entries that solve epoch (SolveEpoch) and uptime (SearchTimeVariable, used by Convert of
+//past times) within tolerance compared to full list. First and last entry of each boot are always kept. Entry can be dropped
+//if its boot time (epoch-uptime) is within tolerance from both kept entries around it on same boot, so either neighbour can
+//be picked. Assumption is that list is sorted and have epochs
+func (p TimeVariableList) Compact(tolerance NsEpoch) TimeVariableList {
+	result := TimeVariableList{}
+	start := 0
+	for start < len(p) {
+		end := start + 1
+		for end < len(p) && p[end].BootNumber == p[start].BootNumber {
+			end++
+		}
+		result = append(result, compactBoot(p[start:end], tolerance)...)
+		start = end
+	}
+	return result
+}
+
+//compactBoot is shortest path over entries on one boot. Entry k can be followed by entry j if all entries in between are within tolerance from k and j
+func compactBoot(arr TimeVariableList, tolerance NsEpoch) TimeVariableList {
+	n := len(arr)
+	if n <= 2 {
+		return append(TimeVariableList{}, arr...)
+	}
+	bootTimes := make([]NsEpoch, n)
+	for i, v := range arr {
+		bootTimes[i] = v.Epoch - NsEpoch(v.Uptime)
+	}
+	count := make([]int, n) //How many kept entries needed up to index
+	prev := make([]int, n)
+	for i := range count {
+		count[i] = n + 1
+	}
+	count[0] = 1
+	for k := 0; k < n-1; k++ {
+		lo, hi := bootTimes[k+1], bootTimes[k+1] //Range of boot times between k and j
+		for j := k + 1; j < n; j++ {
+			if count[k]+1 < count[j] && (j == k+1 || (bootTimes[j].Diff(lo) <= tolerance && bootTimes[j].Diff(hi) <= tolerance)) {
+				count[j] = count[k] + 1
+				prev[j] = k
+			}
+			lo, hi = min(lo, bootTimes[j]), max(hi, bootTimes[j])
+			if tolerance < bootTimes[k].Diff(bootTimes[j]) {
+				break //Entry j can not be dropped after k
+			}
+		}
+	}
+	result := make(TimeVariableList, count[n-1])
+	for i, j := len(result)-1, n-1; 0 <= i; i, j = i-1, prev[j] {
+		result[i] = arr[j]
+	}
+	return result
 }
 
 //SolveBootNumber searches from list. Assumption is that array is sorted.. old at low indexes... newest at higher indexes
@@ -96,7 +188,7 @@ func (p *TimeVariableList) SearchTimeVariable(epoch NsEpoch) (TimeVariable, erro
 	}
 	result := dataInBoot[0] //Initial value
 	diff := result.Epoch.Diff(epoch)
-	for _, v := range *p {
+	for _, v := range dataInBoot { //Entry of other boot can be nearer but gives wrong boot number
 		d := v.Epoch.Diff(epoch)
 		if d < diff {
 			result = v
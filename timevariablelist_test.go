@@ -0,0 +1,141 @@
+package timegopher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/fixregsto"
+	"github.com/stretchr/testify/assert"
+)
+
+//testBootTimes creates list on one boot where boot time (epoch-uptime) drifts as offsets
+func testBootTimes(boot int32, offsets []NsEpoch) TimeVariableList {
+	result := TimeVariableList{}
+	for i, off := range offsets {
+		uptime := NsUptime((i + 1) * 1000)
+		result = append(result, TimeVariable{BootNumber: boot, Uptime: uptime, Epoch: TESTEPOCH0 + NsEpoch(uptime) + off})
+	}
+	return result
+}
+
+func TestSolveEpochOlderBoot(t *testing.T) {
+	lst := append(testBootTimes(1, []NsEpoch{0, 10}), testBootTimes(2, []NsEpoch{500})...)
+
+	epo, epoErr := lst.SolveEpoch(1, 2500)
+	assert.Equal(t, nil, epoErr)
+	assert.Equal(t, NsEpoch(TESTEPOCH0+2500+10), epo)
+
+	epo, epoErr = lst.SolveEpoch(1, 10) //Before first point on boot
+	assert.Equal(t, nil, epoErr)
+	assert.Equal(t, NsEpoch(TESTEPOCH0+10+10), epo)
+
+	_, epoErr = lst.SolveEpoch(3, 10)
+	assert.NotNil(t, epoErr)
+
+	//Same on TimeLog implementations, used by TimeGopher.SolveTime for data from earlier boots
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 100}
+	memFile, _ := memconf.InitMemLoop()
+	memBounded, _ := memconf.InitMemLoop()
+	fileDb, _ := CreateTimeFileDb(&memFile, true)
+	boundedDb, _ := CreateBoundedTimeFileDb(&memBounded, true, 10)
+	memDb := CreateTimeMemDb(true)
+	for _, db := range []TimeLog{&fileDb, &boundedDb, &memDb} {
+		for _, tv := range lst {
+			assert.Equal(t, nil, db.Insert(tv))
+		}
+		epo, epoErr = db.SolveEpoch(1, 100000) //Long after last sync of older boot
+		assert.Equal(t, nil, epoErr)
+		assert.Equal(t, NsEpoch(TESTEPOCH0+100000+10), epo)
+		_, epoErr = db.SolveEpoch(0, 10)
+		assert.NotNil(t, epoErr)
+	}
+}
+
+func TestSearchTimeVariableBoot(t *testing.T) {
+	second := NsEpoch(time.Second)
+	//Boot 2 started 2000s after boot 1, first sync at uptime 5000s. Latest sync of boot 1 is nearer
+	lst := TimeVariableList{
+		{BootNumber: 1, Uptime: NsUptime(10 * second), Epoch: TESTEPOCH0 + 10*second},
+		{BootNumber: 1, Uptime: NsUptime(1000 * second), Epoch: TESTEPOCH0 + 1000*second},
+		{BootNumber: 2, Uptime: NsUptime(5000 * second), Epoch: TESTEPOCH0 + 7000*second},
+	}
+	tv, errSearch := lst.SearchTimeVariable(TESTEPOCH0 + 2100*second)
+	assert.Equal(t, nil, errSearch)
+	assert.Equal(t, lst[2], tv)
+
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 100}
+	memFile, _ := memconf.InitMemLoop()
+	memBounded, _ := memconf.InitMemLoop()
+	fileDb, _ := CreateTimeFileDb(&memFile, true)
+	boundedDb, _ := CreateBoundedTimeFileDb(&memBounded, true, 10)
+	for _, db := range []TimeLog{&fileDb, &boundedDb} {
+		for _, v := range lst {
+			assert.Equal(t, nil, db.Insert(v))
+		}
+		tv, errSearch = db.SearchTimeVariable(TESTEPOCH0 + 2100*second)
+		assert.Equal(t, nil, errSearch)
+		assert.Equal(t, lst[2], tv)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	//Dip to 20 differs too much from both neighbours and can not be dropped
+	lst := testBootTimes(1, []NsEpoch{0, 100, 200, 20, 210, 200})
+	lst = append(lst, testBootTimes(2, []NsEpoch{0, 5, 3})...)
+	lst = append(lst, testBootTimes(3, []NsEpoch{7})...)
+
+	compacted := lst.Compact(100)
+	assert.Equal(t, TimeVariableList{lst[0], lst[2], lst[3], lst[4], lst[5], lst[6], lst[8], lst[9]}, compacted)
+
+	for _, v := range lst {
+		for _, uptime := range []NsUptime{v.Uptime, v.Uptime + 500} {
+			orig, origErr := lst.SolveEpoch(v.BootNumber, uptime)
+			assert.Equal(t, nil, origErr)
+			got, gotErr := compacted.SolveEpoch(v.BootNumber, uptime)
+			assert.Equal(t, nil, gotErr)
+			assert.LessOrEqual(t, orig.Diff(got), NsEpoch(100))
+		}
+	}
+
+	assert.Equal(t, lst, lst.Compact(-1))
+}
+
+func TestCompactConvert(t *testing.T) {
+	//Entry at 100 is within tolerance from previous but not from next, SearchTimeVariable could pick next
+	lst := testBootTimes(1, []NsEpoch{0, 100, 300})
+	assert.Equal(t, lst, lst.Compact(100))
+
+	lst = testBootTimes(1, []NsEpoch{0, 100, 300, 310, 390, 320, 200, 250})
+	compacted := lst.Compact(100)
+	assert.Less(t, len(compacted), len(lst))
+	for _, v := range lst {
+		for _, epoch := range []NsEpoch{v.Epoch - 400, v.Epoch, v.Epoch + 400} {
+			orig, origErr := lst.SearchTimeVariable(epoch)
+			assert.Equal(t, nil, origErr)
+			got, gotErr := compacted.SearchTimeVariable(epoch)
+			assert.Equal(t, nil, gotErr)
+			//Convert solves uptime as epoch - boot time of picked entry
+			assert.LessOrEqual(t, (orig.Epoch - NsEpoch(orig.Uptime)).Diff(got.Epoch-NsEpoch(got.Uptime)), NsEpoch(100))
+		}
+	}
+}
+
+func TestCompactTo(t *testing.T) {
+	memconf := fixregsto.MemloopConf{RecordSize: RECORDSIZE_TIMEVARIABLE_RTC, MaxRecords: 16}
+	mem, _ := memconf.InitMemLoop()
+	dut, _ := CreateTimeFileDb(&mem, true)
+	for _, v := range testBootTimes(1, []NsEpoch{0, 1, 2, 3, 5}) {
+		assert.Equal(t, nil, dut.Insert(v))
+	}
+
+	target, _ := memconf.InitMemLoop()
+	compacted, errCompact := dut.CompactTo(&target, 10)
+	assert.Equal(t, nil, errCompact)
+	n, _ := compacted.Len()
+	assert.Equal(t, 2, n)
+	raw, _ := target.ReadAll()
+	assert.Equal(t, 2*RECORDSIZE_TIMEVARIABLE_RTC, len(raw))
+
+	_, errNotEmpty := dut.CompactTo(&target, 10)
+	assert.NotNil(t, errNotEmpty)
+}